@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/jsonlog"
+)
+
+// adminRoutes serves operational endpoints on a separate listener, so they
+// are not exposed through the public port. /metrics is left open for the
+// Prometheus scraper. The expvar and pprof endpoints reveal enough about the
+// process that they are only served when an admin password is configured,
+// and then require basic auth.
+func (app *application) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/metrics", app.metrics.Handler())
+
+	if app.config.admin.password == "" {
+		app.logger.Warn("no admin password configured, debug endpoints are disabled")
+		return mux
+	}
+
+	debug := http.NewServeMux()
+
+	debug.HandleFunc("/debug/vars", expvarHandler)
+
+	// pprof.Cmdline is left out, like cmdline in expvarHandler, since the
+	// command line can hold the database DSN and the admin password. Index
+	// answers /debug/pprof/cmdline with a 404 instead.
+	debug.HandleFunc("/debug/pprof/", pprof.Index)
+	debug.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	debug.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	debug.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.Handle("/debug/", app.requireBasicAuth(debug))
+
+	return mux
+}
+
+// expvarHandler is expvar.Handler without the cmdline variable, which expvar
+// publishes itself and which can't be unpublished.
+func expvarHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	fmt.Fprintf(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key == "cmdline" {
+			return
+		}
+		if !first {
+			fmt.Fprintf(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
+
+func (app *application) requireBasicAuth(next http.Handler) http.Handler {
+	// Hashing both sides first makes the comparisons constant time even when
+	// the lengths differ.
+	expectedUsername := sha256.Sum256([]byte(app.config.admin.username))
+	expectedPassword := sha256.Sum256([]byte(app.config.admin.password))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if ok {
+			usernameHash := sha256.Sum256([]byte(username))
+			passwordHash := sha256.Sum256([]byte(password))
+
+			usernameMatch := subtle.ConstantTimeCompare(usernameHash[:], expectedUsername[:]) == 1
+			passwordMatch := subtle.ConstantTimeCompare(passwordHash[:], expectedPassword[:]) == 1
+
+			if usernameMatch && passwordMatch {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// publishExpvars adds the application's variables to /debug/vars, next to
+// the memstats that expvar publishes itself. It must only be
+// called once.
+func (app *application) publishExpvars() {
+	expvar.NewString("version").Set(version)
+
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+
+	expvar.Publish("background_tasks", expvar.Func(func() any {
+		return app.backgroundTasks.Load()
+	}))
+
+	expvar.Publish("database", expvar.Func(func() any {
+		return app.db.Stats()
+	}))
+}
+
+// serveAdmin starts the admin server in the background. It returns nil if
+// the admin server is disabled.
+func (app *application) serveAdmin() *http.Server {
+	if app.config.admin.addr == "" {
+		return nil
+	}
+
+	srv := &http.Server{
+		Addr:        app.config.admin.addr,
+		Handler:     app.adminRoutes(),
+		IdleTimeout: time.Minute,
+		ReadTimeout: 10 * time.Second,
+		// CPU profiles and traces stream for as long as requested, 30s by
+		// default.
+		WriteTimeout: 2 * time.Minute,
+		ErrorLog:     log.New(app.logger, "", 0),
+	}
+
+	go func() {
+		app.logger.Info("starting admin server", jsonlog.String("addr", srv.Addr))
+
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			app.logger.Error(err.Error(), jsonlog.String("component", "admin"))
+		}
+	}()
+
+	return srv
+}
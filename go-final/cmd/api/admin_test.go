@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newAdminTestApp(t *testing.T, password string) *application {
+	app := newTestApplication(t)
+	app.config.admin.username = "admin"
+	app.config.admin.password = password
+	return app
+}
+
+func TestAdminRoutes(t *testing.T) {
+	handler := newAdminTestApp(t, "secret").adminRoutes()
+
+	tests := []struct {
+		name     string
+		path     string
+		password string
+		want     int
+	}{
+		{"metrics without auth", "/metrics", "", http.StatusOK},
+		{"vars without auth", "/debug/vars", "", http.StatusUnauthorized},
+		{"vars with wrong password", "/debug/vars", "wrong", http.StatusUnauthorized},
+		{"vars", "/debug/vars", "secret", http.StatusOK},
+		{"pprof without auth", "/debug/pprof/", "", http.StatusUnauthorized},
+		{"pprof", "/debug/pprof/", "secret", http.StatusOK},
+		{"pprof cmdline", "/debug/pprof/cmdline", "secret", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.password != "" {
+				r.SetBasicAuth("admin", tt.password)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.want {
+				t.Errorf("got status %d; want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesWithoutPassword(t *testing.T) {
+	handler := newAdminTestApp(t, "").adminRoutes()
+
+	for path, want := range map[string]int{"/metrics": http.StatusOK, "/debug/vars": http.StatusNotFound} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rr.Code != want {
+			t.Errorf("%s: got status %d; want %d", path, rr.Code, want)
+		}
+	}
+}
+
+func TestExpvarHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	expvarHandler(rr, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+
+	var vars map[string]json.RawMessage
+	err := json.Unmarshal(rr.Body.Bytes(), &vars)
+	if err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, rr.Body)
+	}
+	if _, ok := vars["cmdline"]; ok {
+		t.Error("cmdline is published")
+	}
+	if _, ok := vars["memstats"]; !ok {
+		t.Error("memstats is missing")
+	}
+}
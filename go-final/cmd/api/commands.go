@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/validator"
+)
+
+const commandsUsage = `usage: api [flags] users create -email E -name N [-role R] [-locale L] [-password P] [-activated=false]
+       api [flags] users activate -email E
+       api [flags] users reset-password -email E [-password P]
+       api [flags] tokens list -email E
+       api [flags] tokens revoke -email E [-scope S]
+       api [flags] tokens purge
+       api [flags] seed FILE
+       api [flags] reindex [TABLE...]`
+
+// runCommand implements the operational subcommands, for tasks that are
+// deliberately not exposed over HTTP, such as creating the first admin. They
+// use the same configuration and models as the server.
+func runCommand(cfg config, args []string) error {
+	commands := map[string]func(ctx context.Context, models data.Models, args []string) error{
+		"users create":         createUserCommand,
+		"users activate":       activateUserCommand,
+		"users reset-password": resetPasswordCommand,
+		"tokens list":          listTokensCommand,
+		"tokens revoke":        revokeTokensCommand,
+		"tokens purge":         purgeTokensCommand,
+	}
+
+	// These work on the database as a whole rather than through a model.
+	dbCommands := map[string]func(ctx context.Context, db *sql.DB, args []string) error{
+		"seed":    seedCommand,
+		"reindex": reindexCommand,
+	}
+
+	var run func(ctx context.Context, db *sql.DB, args []string) error
+
+	switch {
+	case dbCommands[args[0]] != nil:
+		run, args = dbCommands[args[0]], args[1:]
+	case len(args) >= 2 && commands[args[0]+" "+args[1]] != nil:
+		command := commands[args[0]+" "+args[1]]
+		run = func(ctx context.Context, db *sql.DB, args []string) error {
+			return command(ctx, data.NewModels(db), args)
+		}
+		args = args[2:]
+	default:
+		return errors.New(commandsUsage)
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return run(context.Background(), db, args)
+}
+
+// newCommandFlags returns a flag set for a subcommand. Errors are returned
+// rather than exiting, so they're reported like any other failure.
+func newCommandFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// validationError turns the errors collected by v into one error.
+func validationError(v *validator.Validator) error {
+	var msgs []string
+	for _, key := range sortedKeys(v.Errors) {
+		msgs = append(msgs, key+" "+v.Errors[key])
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+func createUserCommand(ctx context.Context, models data.Models, args []string) error {
+	fs := newCommandFlags("users create")
+	email := fs.String("email", "", "Email address of the new user")
+	name := fs.String("name", "", "Name of the new user")
+	role := fs.String("role", data.DefaultRole, "Role of the new user")
+	locale := fs.String("locale", data.SupportedLocales[0], "Locale for the user's emails")
+	plaintext := fs.String("password", "", "Password (default a random one, printed once)")
+	activated := fs.Bool("activated", true, "Create the user already activated")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// Passwords given on the command line end up in the shell history, so by
+	// default a random one is generated and printed once.
+	generated := *plaintext == ""
+	if generated {
+		*plaintext, err = randomPassword()
+		if err != nil {
+			return err
+		}
+	}
+
+	user := &data.User{
+		Name:      *name,
+		Email:     *email,
+		Activated: *activated,
+		Role:      *role,
+		Locale:    *locale,
+	}
+
+	err = user.Password.Set(*plaintext)
+	if err != nil {
+		return err
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		return validationError(v)
+	}
+
+	err = models.Users.Insert(ctx, user, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created %s user %d <%s>\n", user.Role, user.ID, user.Email)
+	if generated {
+		fmt.Printf("password: %s\n", *plaintext)
+	}
+	return nil
+}
+
+func activateUserCommand(ctx context.Context, models data.Models, args []string) error {
+	user, err := userFromFlags(ctx, models, "users activate", args)
+	if err != nil {
+		return err
+	}
+
+	if user.Activated {
+		fmt.Printf("user %d <%s> is already activated\n", user.ID, user.Email)
+		return nil
+	}
+
+	user.Activated = true
+
+	err = models.Users.Activate(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("activated user %d <%s>\n", user.ID, user.Email)
+	return nil
+}
+
+func resetPasswordCommand(ctx context.Context, models data.Models, args []string) error {
+	fs := newCommandFlags("users reset-password")
+	email := fs.String("email", "", "Email address of the user")
+	plaintext := fs.String("password", "", "New password (default a random one, printed once)")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	user, err := models.Users.GetByEmail(ctx, *email)
+	if err != nil {
+		return fmt.Errorf("user %q: %w", *email, err)
+	}
+
+	generated := *plaintext == ""
+	if generated {
+		*plaintext, err = randomPassword()
+		if err != nil {
+			return err
+		}
+	}
+
+	v := validator.New()
+	if data.ValidatePasswordPlaintext(v, *plaintext); !v.Valid() {
+		return validationError(v)
+	}
+
+	err = user.Password.Set(*plaintext)
+	if err != nil {
+		return err
+	}
+
+	err = models.Users.Update(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	// Sign the user out everywhere, in case the old password was compromised.
+	err = models.Tokens.DeleteAllForUser(ctx, data.ScopeAuthentication, user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("reset password for user %d <%s>\n", user.ID, user.Email)
+	if generated {
+		fmt.Printf("password: %s\n", *plaintext)
+	}
+	return nil
+}
+
+func listTokensCommand(ctx context.Context, models data.Models, args []string) error {
+	user, err := userFromFlags(ctx, models, "tokens list", args)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := models.Tokens.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		fmt.Printf("user %d <%s> has no tokens\n", user.ID, user.Email)
+		return nil
+	}
+
+	for _, token := range tokens {
+		fmt.Printf("%-16s expires %s (hash %x)\n", token.Scope, token.Expiry.Format(time.RFC3339), token.Hash[:4])
+	}
+	return nil
+}
+
+func revokeTokensCommand(ctx context.Context, models data.Models, args []string) error {
+	fs := newCommandFlags("tokens revoke")
+	email := fs.String("email", "", "Email address of the user")
+	scope := fs.String("scope", data.ScopeAuthentication, "Scope of the tokens to revoke (activation|authentication)")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(*scope, data.ScopeActivation, data.ScopeAuthentication), "scope", "must be activation or authentication")
+	if !v.Valid() {
+		return validationError(v)
+	}
+
+	user, err := models.Users.GetByEmail(ctx, *email)
+	if err != nil {
+		return fmt.Errorf("user %q: %w", *email, err)
+	}
+
+	err = models.Tokens.DeleteAllForUser(ctx, *scope, user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked %s tokens of user %d <%s>\n", *scope, user.ID, user.Email)
+	return nil
+}
+
+func purgeTokensCommand(ctx context.Context, models data.Models, args []string) error {
+	if len(args) > 0 {
+		return errors.New(commandsUsage)
+	}
+
+	deleted, err := models.Tokens.DeleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("deleted %d expired tokens\n", deleted)
+	return nil
+}
+
+// seedFixture is the format of the file read by the seed command. Courses and
+// instructors use the same fields as the create endpoints.
+type seedFixture struct {
+	Courses []struct {
+		Title          string       `json:"title"`
+		Published_date string       `json:"published_date"`
+		Runtime        data.Runtime `json:"runtime"`
+		Lectures       []string     `json:"lectures"`
+	} `json:"courses"`
+	Instructors []struct {
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Age       int32  `json:"age"`
+	} `json:"instructors"`
+}
+
+func seedCommand(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New(commandsUsage)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var fixture seedFixture
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&fixture)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	// Validate everything first, so that mistakes are reported before
+	// anything is inserted. The inserts share one transaction, so a failure
+	// there doesn't leave the database half seeded either.
+	courses := make([]*data.Course, len(fixture.Courses))
+	for i, input := range fixture.Courses {
+		courses[i] = &data.Course{
+			Title:          input.Title,
+			Published_date: input.Published_date,
+			Runtime:        input.Runtime,
+			Lectures:       input.Lectures,
+		}
+
+		v := validator.New()
+		if data.ValidateCourse(v, courses[i]); !v.Valid() {
+			return fmt.Errorf("course %d: %w", i+1, validationError(v))
+		}
+	}
+
+	instructors := make([]*data.Instructors, len(fixture.Instructors))
+	for i, input := range fixture.Instructors {
+		instructors[i] = &data.Instructors{
+			FirstName: input.FirstName,
+			LastName:  input.LastName,
+			Age:       input.Age,
+		}
+
+		v := validator.New()
+		if data.ValidateInstructor(v, instructors[i]); !v.Valid() {
+			return fmt.Errorf("instructor %d: %w", i+1, validationError(v))
+		}
+	}
+
+	err = data.Seed(ctx, db, courses, instructors)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created %d courses and %d instructors\n", len(courses), len(instructors))
+	return nil
+}
+
+// reindexCommand rebuilds the indexes of the given tables, or of courses,
+// whose search indexes bloat the most, if none are given.
+func reindexCommand(ctx context.Context, db *sql.DB, args []string) error {
+	tables := args
+	if len(tables) == 0 {
+		tables = []string{"courses"}
+	}
+
+	for _, table := range tables {
+		if !validator.PermittedValue(table, data.ReindexTables...) {
+			return fmt.Errorf("can't reindex %q; tables are %s", table, strings.Join(data.ReindexTables, ", "))
+		}
+	}
+
+	for _, table := range tables {
+		err := data.Reindex(ctx, db, table)
+		if err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		fmt.Printf("reindexed %s\n", table)
+	}
+	return nil
+}
+
+func userFromFlags(ctx context.Context, models data.Models, name string, args []string) (*data.User, error) {
+	fs := newCommandFlags(name)
+	email := fs.String("email", "", "Email address of the user")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := models.Users.GetByEmail(ctx, *email)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: %w", *email, err)
+	}
+	return user, nil
+}
+
+// randomPassword returns a password for the user to change after signing in.
+func randomPassword() (string, error) {
+	secret, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	return secret[:20], nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/dbtest"
+)
+
+// newCommandModels returns models backed by a stub database that knows the
+// one user alice@example.com.
+func newCommandModels(t *testing.T) (data.Models, *dbtest.DB) {
+	t.Helper()
+
+	db, stub := dbtest.New(t)
+	stub.Query("FROM users WHERE email = $1", func(args []any) (*dbtest.Rows, error) {
+		rows := &dbtest.Rows{Columns: []string{"id", "created_at", "name", "email", "password_hash", "activated", "version", "role", "locale"}}
+		if args[0] == "alice@example.com" {
+			rows.Values = append(rows.Values, []any{int64(1), time.Now(), "Alice", "alice@example.com", []byte("hash"), true, int64(1), "user", "en"})
+		}
+		return rows, nil
+	})
+	return data.NewModels(db), stub
+}
+
+func TestRunCommandUsage(t *testing.T) {
+	for _, args := range [][]string{{"users"}, {"users", "delete"}, {"tokens", "rotate"}, {"backup"}} {
+		err := runCommand(config{}, args)
+		if err == nil || err.Error() != commandsUsage {
+			t.Errorf("%q: got %v; want the usage", args, err)
+		}
+	}
+}
+
+func TestCreateUserCommand(t *testing.T) {
+	models, stub := newCommandModels(t)
+
+	var inserted []any
+	stub.Query("INSERT INTO users", func(args []any) (*dbtest.Rows, error) {
+		inserted = args
+		return &dbtest.Rows{Columns: []string{"id", "created_at", "version"}, Values: [][]any{{int64(2), time.Now(), int64(1)}}}, nil
+	})
+
+	err := createUserCommand(context.Background(), models, []string{"-email", "bob@example.com", "-name", "Bob", "-role", "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted[0] != "Bob" || inserted[1] != "bob@example.com" || inserted[3] != true || inserted[4] != "admin" || inserted[5] != "en" {
+		t.Errorf("got insert %v", inserted)
+	}
+	if commits, _ := stub.Transactions(); commits != 1 {
+		t.Errorf("got %d commits; want 1", commits)
+	}
+
+	inserted = nil
+	err = createUserCommand(context.Background(), models, []string{"-email", "bob@example.com", "-name", "Bob", "-role", "owner"})
+	if err == nil || !strings.Contains(err.Error(), "role") {
+		t.Errorf("unknown role: got %v; want a role error", err)
+	}
+	if inserted != nil {
+		t.Error("user with an unknown role inserted")
+	}
+}
+
+func TestRevokeTokensCommand(t *testing.T) {
+	models, stub := newCommandModels(t)
+
+	var deleted []any
+	stub.Exec("DELETE FROM tokens", func(args []any) (int64, error) {
+		deleted = args
+		return 2, nil
+	})
+
+	err := revokeTokensCommand(context.Background(), models, []string{"-email", "alice@example.com", "-scope", data.ScopeActivation})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted[0] != data.ScopeActivation || deleted[1] != int64(1) {
+		t.Errorf("got delete %v", deleted)
+	}
+
+	// A mistyped scope would otherwise delete nothing and report success.
+	err = revokeTokensCommand(context.Background(), models, []string{"-email", "alice@example.com", "-scope", "authentcation"})
+	if err == nil || !strings.Contains(err.Error(), "scope") {
+		t.Errorf("unknown scope: got %v; want a scope error", err)
+	}
+	if len(stub.Statements()) != 2 {
+		t.Errorf("got statements %q after an unknown scope; want none", stub.Statements()[2:])
+	}
+
+	err = revokeTokensCommand(context.Background(), models, []string{"-email", "nobody@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "nobody@example.com") {
+		t.Errorf("unknown user: got %v", err)
+	}
+}
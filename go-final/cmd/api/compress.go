@@ -0,0 +1,255 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressor is what gzip.Writer and brotli.Writer have in common.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// Encoders are pooled, since each one allocates a large window. Brotli is set
+// to a level that compresses JSON better than gzip at a similar cost; the
+// higher levels are meant for static assets compressed ahead of time.
+var compressorPools = map[string]*sync.Pool{
+	"br": {New: func() any {
+		return brotli.NewWriterLevel(io.Discard, 4)
+	}},
+	"gzip": {New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}},
+}
+
+// compressibleTypes are the media types worth compressing. Event streams are
+// text too, but they're left alone so that each event reaches the client as
+// soon as it is flushed.
+var compressibleTypes = map[string]bool{
+	mediaJSON:                  true,
+	mediaNDJSON:                true,
+	mediaMsgpack:               true,
+	"application/problem+json": true,
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mediaType == "text/event-stream" {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType]
+}
+
+// negotiateEncoding returns the content coding the Accept-Encoding header
+// prefers, br or gzip, or "" to send the response as it is. Brotli wins ties.
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+
+	for _, encoding := range []string{"br", "gzip"} {
+		q, explicit := 0.0, false
+		for _, item := range parseQualityList(acceptEncoding) {
+			switch {
+			case item.value == encoding:
+				q, explicit = item.q, true
+			case item.value == "*" && !explicit:
+				q = item.q
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// compress compresses response bodies when the client accepts it. Bodies are
+// buffered until they reach the minimum size, so small responses, which
+// would barely shrink, are sent as they are.
+func (app *application) compress(next http.Handler) http.Handler {
+	if !app.config.compression.enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        app.config.compression.minSize,
+			status:         http.StatusOK,
+		}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter decides whether to compress once the status and headers are
+// known and either enough of the body has been written or the handler is
+// done.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	compressor  compressor
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+
+	// Informational responses go straight through; the final one follows.
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	cw.status = status
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	if status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusSwitchingProtocols ||
+		h.Get("Content-Encoding") != "" ||
+		(h.Get("Content-Type") != "" && !isCompressible(h.Get("Content-Type"))) {
+		cw.start(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.decided {
+		if cw.compressor != nil {
+			return cw.compressor.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.minSize {
+		err := cw.start(cw.shouldCompress())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+func (cw *compressWriter) shouldCompress() bool {
+	h := cw.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	return isCompressible(h.Get("Content-Type"))
+}
+
+// start sends the headers and anything buffered so far, compressed or not.
+func (cw *compressWriter) start(compress bool) error {
+	cw.decided = true
+
+	if compress {
+		h := cw.Header()
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		cw.compressor = compressorPools[cw.encoding].Get().(compressor)
+		cw.compressor.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.compressor != nil {
+		_, err = cw.compressor.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// FlushError lets http.ResponseController flush through the compressor.
+// Flushing before the minimum size is reached sends the response as it is,
+// since a client waiting for it gains nothing from compression.
+func (cw *compressWriter) FlushError() error {
+	if !cw.decided && cw.wroteHeader {
+		err := cw.start(false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cw.compressor != nil {
+		err := cw.compressor.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Flush() {
+	cw.FlushError()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close sends what is still buffered and finishes the compressed stream.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		// A handler that wrote nothing at all leaves the response to
+		// net/http, as it would without this middleware.
+		if !cw.wroteHeader {
+			return nil
+		}
+		return cw.start(false)
+	}
+
+	if cw.compressor == nil {
+		return nil
+	}
+
+	err := cw.compressor.Close()
+	cw.compressor.Reset(io.Discard)
+	compressorPools[cw.encoding].Put(cw.compressor)
+	cw.compressor = nil
+
+	return err
+}
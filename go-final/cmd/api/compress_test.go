@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, br", "br"},
+		{"gzip, deflate, br;q=0.9", "gzip"},
+		{"*", "br"},
+		{"*, br;q=0", "gzip"},
+		{"GZIP", "gzip"},
+		{"gzip;q=0, br;q=0", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			got := negotiateEncoding(tt.acceptEncoding)
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"title":"Go"}`, 100)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		status         int
+		body           string
+		wantEncoding   string
+	}{
+		{"gzip", "gzip", "application/json", http.StatusOK, large, "gzip"},
+		{"brotli", "gzip, br", "application/json", http.StatusOK, large, "br"},
+		{"small", "gzip", "application/json", http.StatusOK, `{"title":"Go"}`, ""},
+		{"not accepted", "", "application/json", http.StatusOK, large, ""},
+		{"image", "gzip", "image/png", http.StatusOK, large, ""},
+		{"event stream", "gzip", "text/event-stream", http.StatusOK, large, ""},
+		{"detected type", "gzip", "", http.StatusOK, strings.Repeat("plain text ", 200), "gzip"},
+		{"error status", "br", "application/json", http.StatusNotFound, large, "br"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.compression.enabled = true
+			app.config.compression.minSize = 1024
+
+			handler := app.compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				// Write in pieces to check that buffering joins them up.
+				for _, chunk := range []string{tt.body[:len(tt.body)/2], tt.body[len(tt.body)/2:]} {
+					io.WriteString(w, chunk)
+				}
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.status {
+				t.Errorf("got status %d; want %d", rr.Code, tt.status)
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("got Content-Encoding %q; want %q", got, tt.wantEncoding)
+			}
+			if got := rr.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("got Vary %q; want Accept-Encoding", got)
+			}
+			if got := decompress(t, tt.wantEncoding, rr.Body.Bytes()); got != tt.body {
+				t.Errorf("got body of %d bytes; want the %d bytes written", len(got), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestCompressNoContent(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.compression.enabled = true
+	app.config.compression.minSize = 0
+
+	handler := app.compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	r := httptest.NewRequest(http.MethodDelete, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("got status %d; want 204", rr.Code)
+	}
+	if rr.Header().Get("Content-Encoding") != "" || rr.Body.Len() != 0 {
+		t.Errorf("got Content-Encoding %q and %d bytes of body", rr.Header().Get("Content-Encoding"), rr.Body.Len())
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.compression.enabled = true
+	app.config.compression.minSize = 1024
+
+	handler := app.compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, `{"partial":`)
+
+		err := http.NewResponseController(w).Flush()
+		if err != nil {
+			t.Error(err)
+		}
+		io.WriteString(w, `true}`)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, r)
+
+	if !rr.Flushed {
+		t.Error("response was not flushed")
+	}
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Error("response flushed before the minimum size was compressed")
+	}
+	if rr.Body.String() != `{"partial":true}` {
+		t.Errorf("got body %q", rr.Body)
+	}
+}
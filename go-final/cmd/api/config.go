@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sbeknur/go-final/internal/validator"
+)
+
+// secretSettings are masked by -print-config.
+var secretSettings = []string{
+	"admin-password",
+	"db-dsn",
+	"mail-unsubscribe-secret",
+	"smtp-password",
+}
+
+func validateConfig(v *validator.Validator, cfg config) {
+	v.Check(cfg.port > 0 && cfg.port <= 65535, "port", "must be a valid port number")
+	v.Check(validator.PermittedValue(cfg.env, "development", "staging", "production"), "env", "must be development, staging or production")
+	v.Check(cfg.shutdownDelay >= 0, "shutdown-delay", "must not be negative")
+
+	v.Check((cfg.tls.certFile == "") == (cfg.tls.keyFile == ""), "tls-cert", "must be provided together with tls-key")
+	if cfg.tls.redirectAddr != "" {
+		v.Check(cfg.tls.certFile != "", "tls-redirect-addr", "requires tls-cert and tls-key")
+	}
+	v.Check(cfg.tls.hstsMaxAge >= 0, "hsts-max-age", "must not be negative")
+
+	_, err := parseTrustedProxies(cfg.trustedProxies)
+	v.Check(err == nil, "trusted-proxies", "must be IP addresses or CIDR ranges")
+
+	u, err := url.Parse(cfg.baseURL)
+	v.Check(err == nil && u.Scheme != "" && u.Host != "", "base-url", "must be an absolute URL")
+
+	v.Check(cfg.db.dsn != "", "db-dsn", "must be provided")
+	v.Check(cfg.db.maxOpenConns > 0, "db-max-open-conns", "must be greater than zero")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "must not be negative")
+
+	v.Check(cfg.jobs.concurrency > 0, "jobs-concurrency", "must be greater than zero")
+	v.Check(cfg.jobs.maxAttempts > 0, "jobs-max-attempts", "must be greater than zero")
+	v.Check(cfg.jobs.retention > 0, "jobs-retention", "must be greater than zero")
+	v.Check(cfg.events.retention > 0, "events-retention", "must be greater than zero")
+	v.Check(cfg.webhooks.maxAttempts > 0, "webhooks-max-attempts", "must be greater than zero")
+
+	v.Check(validator.PermittedValue(cfg.trace.exporter, "none", "stdout", "otlp"), "trace-exporter", "must be none, stdout or otlp")
+	v.Check(cfg.trace.sampleRatio >= 0 && cfg.trace.sampleRatio <= 1, "trace-sample-ratio", "must be between 0 and 1")
+
+	for _, origin := range splitList(cfg.cors.trustedOrigins) {
+		u, err := url.Parse(origin)
+		v.Check(err == nil && u.Scheme != "" && u.Host != "" && u.Path == "" && u.RawQuery == "", "cors-trusted-origins", "must be origins such as https://app.example.com, without a path")
+	}
+	v.Check(cfg.cors.maxAge >= 0, "cors-max-age", "must not be negative")
+
+	if cfg.limiter.enabled {
+		v.Check(validator.PermittedValue(cfg.limiter.backend, "memory", "postgres"), "limiter-backend", "must be memory or postgres")
+		v.Check(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+		v.Check(cfg.limiter.burst > 0, "limiter-burst", "must be greater than zero")
+		v.Check(cfg.limiter.userRPS > 0, "limiter-user-rps", "must be greater than zero")
+		v.Check(cfg.limiter.userBurst > 0, "limiter-user-burst", "must be greater than zero")
+		v.Check(cfg.limiter.authRPS > 0, "limiter-auth-rps", "must be greater than zero")
+		v.Check(cfg.limiter.authBurst > 0, "limiter-auth-burst", "must be greater than zero")
+		v.Check(cfg.limiter.tokenRPS > 0, "limiter-token-rps", "must be greater than zero")
+		v.Check(cfg.limiter.tokenBurst > 0, "limiter-token-burst", "must be greater than zero")
+	}
+
+	v.Check(cfg.compression.minSize >= 0, "compression-min-size", "must not be negative")
+
+	v.Check(validator.PermittedValue(cfg.mail.transport, "smtp", "file", "stdout"), "mail-transport", "must be smtp, file or stdout")
+	v.Check(cfg.smtp.sender != "", "smtp-sender", "must be provided")
+	if cfg.mail.transport == "smtp" {
+		v.Check(cfg.smtp.host != "", "smtp-host", "must be provided")
+		v.Check(cfg.smtp.port > 0 && cfg.smtp.port <= 65535, "smtp-port", "must be a valid port number")
+	}
+
+	// Without a secret one is derived from the DSN, which is only good enough
+	// for development.
+	if cfg.env != "development" {
+		v.Check(cfg.mail.unsubscribeSecret != "", "mail-unsubscribe-secret", "must be provided outside development")
+	}
+}
+
+// samplingFlag is a flag.Value for -log-sample. Each value is a comma
+// separated list of "message=N" entries, and repeating the flag adds to it.
+type samplingFlag map[string]int
+
+func (f samplingFlag) String() string {
+	entries := make([]string, 0, len(f))
+	for message, perSecond := range f {
+		entries = append(entries, fmt.Sprintf("%s=%d", message, perSecond))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+func (f samplingFlag) Set(s string) error {
+	for _, entry := range splitList(s) {
+		message, n, ok := strings.Cut(entry, "=")
+		if !ok {
+			return errors.New(`must be of the form "message=N"`)
+		}
+
+		perSecond, err := strconv.Atoi(n)
+		if err != nil {
+			return err
+		}
+
+		f[message] = perSecond
+	}
+	return nil
+}
+
+// parseTrustedProxies parses a comma separated list of IP addresses and CIDR
+// ranges. Single addresses become prefixes covering just that address.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, item := range splitList(s) {
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
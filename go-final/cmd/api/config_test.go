@@ -0,0 +1,165 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/validator"
+)
+
+// validTestConfig returns a config that passes validateConfig, for the tests
+// to change one setting at a time.
+func validTestConfig() config {
+	var cfg config
+	cfg.port = 4000
+	cfg.env = "development"
+	cfg.baseURL = "http://localhost:4000"
+	cfg.db.dsn = "postgres://localhost/proedu"
+	cfg.db.maxOpenConns = 25
+	cfg.jobs.concurrency = 1
+	cfg.jobs.maxAttempts = 1
+	cfg.webhooks.maxAttempts = 1
+	cfg.jobs.retention = time.Hour
+	cfg.events.retention = time.Hour
+	cfg.trace.exporter = "none"
+	cfg.mail.transport = "stdout"
+	cfg.smtp.sender = "ProEdu <no-reply@example.com>"
+	return cfg
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *config)
+		errors []string
+	}{
+		{
+			name:   "valid",
+			modify: func(cfg *config) {},
+		},
+		{
+			name:   "no unsubscribe secret in development",
+			modify: func(cfg *config) { cfg.mail.unsubscribeSecret = "" },
+		},
+		{
+			name:   "no unsubscribe secret in staging",
+			modify: func(cfg *config) { cfg.env = "staging" },
+			errors: []string{"mail-unsubscribe-secret"},
+		},
+		{
+			name:   "no unsubscribe secret in production",
+			modify: func(cfg *config) { cfg.env = "production" },
+			errors: []string{"mail-unsubscribe-secret"},
+		},
+		{
+			name: "unsubscribe secret in production",
+			modify: func(cfg *config) {
+				cfg.env = "production"
+				cfg.mail.unsubscribeSecret = "secret"
+			},
+		},
+		{
+			name:   "smtp without host",
+			modify: func(cfg *config) { cfg.mail.transport = "smtp" },
+			errors: []string{"smtp-host", "smtp-port"},
+		},
+		{
+			name:   "memory mail transport",
+			modify: func(cfg *config) { cfg.mail.transport = "memory" },
+			errors: []string{"mail-transport"},
+		},
+		{
+			name:   "unknown environment",
+			modify: func(cfg *config) { cfg.env = "test" },
+			errors: []string{"env", "mail-unsubscribe-secret"},
+		},
+		{
+			name:   "invalid port",
+			modify: func(cfg *config) { cfg.port = 70000 },
+			errors: []string{"port"},
+		},
+		{
+			name:   "relative base URL",
+			modify: func(cfg *config) { cfg.baseURL = "/api" },
+			errors: []string{"base-url"},
+		},
+		{
+			name:   "no DSN",
+			modify: func(cfg *config) { cfg.db.dsn = "" },
+			errors: []string{"db-dsn"},
+		},
+		{
+			name: "TLS key without certificate",
+			modify: func(cfg *config) {
+				cfg.tls.keyFile = "key.pem"
+				cfg.tls.redirectAddr = ":80"
+			},
+			errors: []string{"tls-cert", "tls-redirect-addr"},
+		},
+		{
+			name:   "trusted proxy that isn't an address",
+			modify: func(cfg *config) { cfg.trustedProxies = "10.0.0.0/8, proxy.internal" },
+			errors: []string{"trusted-proxies"},
+		},
+		{
+			name:   "CORS origin with a path",
+			modify: func(cfg *config) { cfg.cors.trustedOrigins = "https://app.example.com/login" },
+			errors: []string{"cors-trusted-origins"},
+		},
+		{
+			name: "limiter settings are only checked when it is enabled",
+			modify: func(cfg *config) {
+				cfg.limiter.backend = "redis"
+			},
+		},
+		{
+			name: "enabled limiter",
+			modify: func(cfg *config) {
+				cfg.limiter.enabled = true
+				cfg.limiter.backend = "redis"
+			},
+			errors: []string{"limiter-backend", "limiter-rps", "limiter-burst", "limiter-user-rps", "limiter-user-burst", "limiter-auth-rps", "limiter-auth-burst", "limiter-token-rps", "limiter-token-burst"},
+		},
+		{
+			name:   "unknown trace exporter",
+			modify: func(cfg *config) { cfg.trace.exporter = "jaeger" },
+			errors: []string{"trace-exporter"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validTestConfig()
+			tt.modify(&cfg)
+
+			v := validator.New()
+			validateConfig(v, cfg)
+
+			if len(v.Errors) != len(tt.errors) {
+				t.Errorf("got errors %v; want errors for %v", v.Errors, tt.errors)
+			}
+			for _, key := range tt.errors {
+				if _, ok := v.Errors[key]; !ok {
+					t.Errorf("got no error for %s", key)
+				}
+			}
+		})
+	}
+}
+
+func TestDevelopmentSecret(t *testing.T) {
+	a := developmentSecret("mail-unsubscribe-secret", "postgres://localhost/proedu")
+
+	if a != developmentSecret("mail-unsubscribe-secret", "postgres://localhost/proedu") {
+		t.Error("got a different secret for the same seed")
+	}
+	if a == developmentSecret("mail-unsubscribe-secret", "postgres://localhost/other") {
+		t.Error("got the same secret for another seed")
+	}
+	if a == developmentSecret("admin-password", "postgres://localhost/proedu") {
+		t.Error("got the same secret for another setting")
+	}
+	if len(a) != 64 {
+		t.Errorf("got a secret of %d characters; want 64", len(a))
+	}
+}
@@ -5,13 +5,29 @@ import (
 	"net/http"
 
 	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/jsonlog"
 )
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey         = contextKey("user")
+	requestIDContextKey    = contextKey("requestID")
+	requestStateContextKey = contextKey("requestState")
+)
+
+// requestState is shared between the middleware in the chain. Values set by
+// inner handlers, like the authenticated user, are visible to the request
+// logger once the request completes.
+type requestState struct {
+	user *data.User
+}
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	if state, ok := r.Context().Value(requestStateContextKey).(*requestState); ok {
+		state.user = user
+	}
+
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -24,3 +40,17 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	ctx = context.WithValue(ctx, requestStateContextKey, &requestState{})
+	ctx = jsonlog.ContextWithFields(ctx, jsonlog.String("request_id", requestID))
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the request ID, or an empty string for requests
+// that didn't pass through the logRequest middleware.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Preflight requests from trusted origins may ask for these methods and
+// headers. Simple headers such as Accept don't need to be listed, and scripts
+// can read the exposed response headers in addition to the simple ones.
+var (
+	corsAllowedMethods = []string{http.MethodOptions, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	corsAllowedHeaders = []string{"Authorization", "Content-Type", "X-Request-ID"}
+	corsExposedHeaders = []string{"Location", "Link", "X-Total-Count", "X-Request-ID", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"}
+)
+
+// enableCORS lets browsers on the origins in -cors-trusted-origins call the
+// API, including with credentials. Preflight requests are answered here,
+// since the router would otherwise reply 405 to OPTIONS.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	trusted := make(map[string]bool)
+	for _, origin := range splitList(app.config.cors.trustedOrigins) {
+		trusted[origin] = true
+	}
+
+	maxAge := strconv.Itoa(int(app.config.cors.maxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on these headers, so caches must not serve it
+		// for requests from other origins.
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" || !trusted[origin] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsAllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+
+		next.ServeHTTP(w, r)
+	})
+}
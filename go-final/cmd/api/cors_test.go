@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCORSHandler(t *testing.T) http.Handler {
+	t.Helper()
+
+	app := newTestApplication(t)
+	app.config.cors.trustedOrigins = "https://app.example.com, https://admin.example.com"
+	app.config.cors.maxAge = 10 * time.Minute
+
+	return app.enableCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+}
+
+func TestCORSTrustedOrigin(t *testing.T) {
+	handler := newCORSHandler(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/courses", nil)
+	r.Header.Set("Origin", "https://admin.example.com")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("got status %d; want the handler's %d", rr.Code, http.StatusTeapot)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+		t.Errorf("got Access-Control-Allow-Origin %q", got)
+	}
+	if rr.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("credentials not allowed")
+	}
+	exposed := rr.Header().Get("Access-Control-Expose-Headers")
+	for _, header := range []string{"Link", "X-Total-Count", "RateLimit-Remaining", "Retry-After"} {
+		if !strings.Contains(exposed, header) {
+			t.Errorf("%s isn't exposed: %q", header, exposed)
+		}
+	}
+	if vary := rr.Header().Values("Vary"); len(vary) != 2 || vary[0] != "Origin" {
+		t.Errorf("got Vary %q", vary)
+	}
+}
+
+func TestCORSUntrustedOrigin(t *testing.T) {
+	handler := newCORSHandler(t)
+
+	for _, origin := range []string{"", "https://evil.example.com", "https://app.example.com.evil.example.com", "null"} {
+		r := httptest.NewRequest(http.MethodOptions, "/v1/courses", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		r.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusTeapot {
+			t.Errorf("origin %q: got status %d; want the request passed on", origin, rr.Code)
+		}
+		for _, header := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Access-Control-Allow-Methods"} {
+			if rr.Header().Get(header) != "" {
+				t.Errorf("origin %q: got %s", origin, header)
+			}
+		}
+		if rr.Header().Get("Vary") == "" {
+			t.Errorf("origin %q: response doesn't vary by origin", origin)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	handler := newCORSHandler(t)
+
+	r := httptest.NewRequest(http.MethodOptions, "/v1/courses/1", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	r.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusNoContent)
+	}
+	if !strings.Contains(rr.Header().Get("Access-Control-Allow-Methods"), http.MethodPatch) {
+		t.Errorf("got Access-Control-Allow-Methods %q", rr.Header().Get("Access-Control-Allow-Methods"))
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Authorization") || !strings.Contains(got, "Content-Type") {
+		t.Errorf("got Access-Control-Allow-Headers %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("got Access-Control-Max-Age %q; want 600", got)
+	}
+
+	// A plain OPTIONS request isn't a preflight and goes to the router.
+	r = httptest.NewRequest(http.MethodOptions, "/v1/courses/1", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("OPTIONS without Access-Control-Request-Method: got status %d; want it passed on", rr.Code)
+	}
+}
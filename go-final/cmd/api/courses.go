@@ -37,16 +37,18 @@ func (app *application) createCourseHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Courses.Insert(course)
+	err = app.models.Courses.Insert(r.Context(), course)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	app.publishEvent(r.Context(), 0, data.EventCourseCreated, course)
+
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/courses/%d", course.ID))
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"course": course}, headers)
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"course": course}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -59,7 +61,7 @@ func (app *application) showCourseHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	course, err := app.models.Courses.Get(id)
+	course, err := app.models.Courses.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -70,7 +72,7 @@ func (app *application) showCourseHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"course": course}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"course": course}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -83,7 +85,7 @@ func (app *application) updateCourseHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	course, err := app.models.Courses.Get(id)
+	course, err := app.models.Courses.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrInvalidRuntimeFormat):
@@ -130,7 +132,7 @@ func (app *application) updateCourseHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Courses.Update(course)
+	err = app.models.Courses.Update(r.Context(), course)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -141,7 +143,10 @@ func (app *application) updateCourseHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"course": course}, nil)
+	app.publishEvent(r.Context(), 0, data.EventCourseUpdated, course)
+	app.notifyCourseUpdated(r.Context(), course)
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"course": course}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -154,7 +159,7 @@ func (app *application) deleteCourseHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Courses.Delete(id)
+	err = app.models.Courses.Delete(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -165,7 +170,9 @@ func (app *application) deleteCourseHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "course successfully deleted"}, nil)
+	app.publishEvent(r.Context(), 0, data.EventCourseDeleted, envelope{"id": id})
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "course successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -193,13 +200,13 @@ func (app *application) listCoursesHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	courses, metadata, err := app.models.Courses.GetAll(input.Title, input.Lectures, input.Filters)
+	courses, metadata, err := app.models.Courses.GetAll(r.Context(), input.Title, input.Lectures, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"courses": courses, "metadata": metadata}, nil)
+	err = app.writeCollection(w, r, "courses", courses, metadata)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/jsonlog"
+	"github.com/sbeknur/go-final/internal/ratelimit"
+	"github.com/sbeknur/go-final/internal/scheduler"
+)
+
+// staleUploadAge is how old an empty upload file must be before it is
+// considered abandoned rather than still being written.
+const staleUploadAge = time.Hour
+
+const digestPeriod = 7 * 24 * time.Hour
+
+func (app *application) newScheduler() (*scheduler.Scheduler, error) {
+	s := scheduler.New(app.db, app.logger, 10*time.Minute)
+
+	err := s.Add("purge_expired_tokens", app.config.cron.purgeTokens, app.purgeExpiredTokensTask)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Add("clean_stale_uploads", app.config.cron.cleanUploads, app.cleanStaleUploadsTask)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Add("purge_finished_jobs", app.config.cron.purgeJobs, app.purgeFinishedJobsTask)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Add("purge_old_events", app.config.cron.purgeEvents, app.purgeOldEventsTask)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Add("send_digests", app.config.cron.sendDigests, app.sendDigestsTask)
+	if err != nil {
+		return nil, err
+	}
+
+	if limiter, ok := app.limiter.(*ratelimit.Postgres); ok {
+		err = s.Add("purge_rate_limits", app.config.cron.purgeLimits, func(ctx context.Context) error {
+			count, err := limiter.DeleteFull(ctx)
+			if err != nil {
+				return err
+			}
+
+			app.logger.Debug("purged idle rate limit buckets", jsonlog.Int64("count", count))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (app *application) purgeExpiredTokensTask(ctx context.Context) error {
+	count, err := app.models.Tokens.DeleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("purged expired tokens", map[string]string{
+		"count": strconv.FormatInt(count, 10),
+	})
+	return nil
+}
+
+func (app *application) purgeFinishedJobsTask(ctx context.Context) error {
+	count, err := app.jobs.DeleteFinished(ctx, app.config.jobs.retention)
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("purged finished jobs", map[string]string{
+		"count": strconv.FormatInt(count, 10),
+	})
+	return nil
+}
+
+// purgeOldEventsTask deletes events that are too old to be worth replaying
+// to a client that reconnects.
+func (app *application) purgeOldEventsTask(ctx context.Context) error {
+	count, err := app.models.Events.DeleteOlderThan(ctx, time.Now().Add(-app.config.events.retention))
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("purged old events", map[string]string{
+		"count": strconv.FormatInt(count, 10),
+	})
+	return nil
+}
+
+// cleanStaleUploadsTask removes empty files left behind by uploads that
+// failed or were abandoned part way through.
+func (app *application) cleanStaleUploadsTask(ctx context.Context) error {
+	removed := 0
+
+	for _, dir := range []string{imageUploadDir, pdfUploadDir} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasPrefix(entry.Name(), "upload-") {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+
+			if info.Size() > 0 || time.Since(info.ModTime()) < staleUploadAge {
+				continue
+			}
+
+			err = os.Remove(filepath.Join(dir, entry.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removed++
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	app.logger.PrintInfo("cleaned stale uploads", map[string]string{
+		"count": strconv.Itoa(removed),
+	})
+	return nil
+}
+
+// sendDigestsTask queues a digest email for everyone with unread
+// notifications from the last week. The emails themselves are sent by the
+// job queue, which respects the digest notification preference.
+func (app *application) sendDigestsTask(ctx context.Context) error {
+	userIDs, err := app.models.Notifications.GetUsersWithUnread(ctx, time.Now().Add(-digestPeriod))
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		err = app.jobs.Enqueue(ctx, jobSendDigest, sendDigestArgs{UserID: userID})
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	app.logger.PrintInfo("queued digests", map[string]string{
+		"count": strconv.Itoa(len(userIDs)),
+	})
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+
+	data "github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/mailer"
+	"github.com/sbeknur/go-final/internal/validator"
+)
+
+func (app *application) listEmailTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := mailer.Templates()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"templates": templates}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) previewEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Template string         `json:"template"`
+		Locale   string         `json:"locale"`
+		Data     map[string]any `json:"data"`
+		SendTo   string         `json:"send_to"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	templates, err := mailer.Templates()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Template != "", "template", "must be provided")
+	_, ok := templates[input.Template]
+	v.Check(ok, "template", "unknown template")
+	if input.Locale != "" {
+		data.ValidateLocale(v, input.Locale)
+	}
+	if input.SendTo != "" {
+		data.ValidateEmail(v, input.SendTo)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Fall back to the built-in sample data so that a template can be checked
+	// without having to know which keys it expects.
+	if input.Data == nil {
+		input.Data = mailer.SampleData(input.Template)
+	}
+
+	msg, err := app.mailer.Render(mailer.Recipient{Email: input.SendTo, Locale: input.Locale}, input.Template, input.Data)
+	if err != nil {
+		v.AddError("template", err.Error())
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sent := false
+	if input.SendTo != "" {
+		err = app.mailer.Deliver(r.Context(), msg)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		sent = true
+	}
+
+	preview := envelope{
+		"subject":    msg.Subject,
+		"plain_body": msg.PlainBody,
+		"html_body":  msg.HTMLBody,
+		"sent":       sent,
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"preview": preview}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type emailPreview struct {
+	Subject   string `json:"subject"`
+	PlainBody string `json:"plain_body"`
+	HTMLBody  string `json:"html_body"`
+	Sent      bool   `json:"sent"`
+}
+
+func previewEmail(t *testing.T, app *application, body string) (int, emailPreview, map[string]string) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	app.previewEmailHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/emails/preview", strings.NewReader(body)))
+
+	var response struct {
+		Preview emailPreview      `json:"preview"`
+		Error   map[string]string `json:"error"`
+	}
+	if rr.Code == http.StatusOK || rr.Code == http.StatusUnprocessableEntity {
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: %v", rr.Body, err)
+		}
+	}
+	return rr.Code, response.Preview, response.Error
+}
+
+func TestListEmailTemplates(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	app.listEmailTemplatesHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/emails/templates", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+
+	var response struct {
+		Templates map[string][]string `json:"templates"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(response.Templates["user_welcome.tmpl"], ","); got != "en,kk,ru" {
+		t.Errorf("got user_welcome.tmpl locales %q; want en,kk,ru", got)
+	}
+}
+
+func TestPreviewEmail(t *testing.T) {
+	app := newTestApplication(t)
+	transport := useMemoryMailer(app)
+
+	// Without data the sample data is used, and nothing is sent.
+	status, preview, _ := previewEmail(t, app, `{"template": "user_welcome.tmpl"}`)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+	if preview.Subject != "Welcome to ProEdu!" || !strings.Contains(preview.PlainBody, "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU") || preview.HTMLBody == "" || preview.Sent {
+		t.Errorf("got preview %+v", preview)
+	}
+	if len(transport.Messages()) != 0 {
+		t.Error("preview sent without send_to")
+	}
+
+	status, preview, _ = previewEmail(t, app, `{"template": "user_welcome.tmpl", "locale": "ru"}`)
+	if status != http.StatusOK || preview.Subject != "Добро пожаловать в ProEdu!" {
+		t.Errorf("ru: got status %d and subject %q", status, preview.Subject)
+	}
+
+	status, preview, _ = previewEmail(t, app, `{"template": "course_update.tmpl", "data": {"userName": "Daniyar", "courseID": 3, "courseTitle": "Databases"}, "send_to": "admin@example.com"}`)
+	if status != http.StatusOK || !preview.Sent || !strings.Contains(preview.PlainBody, "Databases") {
+		t.Fatalf("send_to: got status %d and preview %+v", status, preview)
+	}
+	if msg, ok := transport.Last("admin@example.com"); !ok || msg.Subject != preview.Subject {
+		t.Errorf("send_to: got sent %+v; want the previewed email", msg)
+	}
+}
+
+func TestPreviewEmailErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{"no template", `{}`, "template"},
+		{"unknown template", `{"template": "password_reset.tmpl"}`, "template"},
+		{"unknown locale", `{"template": "digest.tmpl", "locale": "de"}`, "locale"},
+		{"bad address", `{"template": "digest.tmpl", "send_to": "admin"}`, "email"},
+		{"missing data", `{"template": "digest.tmpl", "data": {"userName": "Aigerim"}}`, "template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			transport := useMemoryMailer(app)
+
+			status, _, errs := previewEmail(t, app, tt.body)
+			if status != http.StatusUnprocessableEntity || errs[tt.field] == "" {
+				t.Errorf("got status %d and errors %v; want %d with an error for %s", status, errs, http.StatusUnprocessableEntity, tt.field)
+			}
+			if len(transport.Messages()) != 0 {
+				t.Error("sent an email")
+			}
+		})
+	}
+}
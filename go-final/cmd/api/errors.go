@@ -3,19 +3,28 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
+
+	"github.com/sbeknur/go-final/internal/jsonlog"
 )
 
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintError(err, map[string]string{
-		"request_method": r.Method,
-		"request_url":    r.URL.String(),
-	})
+	app.logger.ErrorContext(r.Context(), err.Error(),
+		jsonlog.String("request_method", r.Method),
+		jsonlog.String("request_url", r.URL.String()),
+	)
 }
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
 	env := envelope{"error": message}
 
-	err := app.writeJSON(w, status, env, nil)
+	// Clients can quote the request ID when reporting a problem, which lets us
+	// find the matching log lines.
+	if requestID := app.contextGetRequestID(r); requestID != "" {
+		env["request_id"] = requestID
+	}
+
+	err := app.writeJSON(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
@@ -26,7 +35,7 @@ func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Reque
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, message)
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
@@ -39,6 +48,11 @@ func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.
 	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request, available []string) {
+	message := fmt.Sprintf("this resource is available as %s", strings.Join(available, ", "))
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
+
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
@@ -65,6 +79,13 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 }
 
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	// These can come in floods, so the logger is set up to sample this message
+	// (see the -log-sample flag).
+	app.logger.WarnContext(r.Context(), "rate limit exceeded",
+		jsonlog.String("ip", app.clientIP(r)),
+		jsonlog.String("request_path", r.URL.Path),
+	)
+
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerErrorResponse(t *testing.T) {
+	app := newTestApplication(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/courses/1", nil)
+	r = app.contextSetRequestID(r, "test-request-id")
+	rr := httptest.NewRecorder()
+
+	app.serverErrorResponse(rr, r, errors.New("connection refused"))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusInternalServerError)
+	}
+
+	var body struct {
+		Error     string `json:"error"`
+		RequestID string `json:"request_id"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body.RequestID != "test-request-id" {
+		t.Errorf("got request_id %q; want test-request-id", body.RequestID)
+	}
+	if body.Error != "the server encountered a problem and could not process your request" {
+		t.Errorf("got error %q, which may reveal the cause", body.Error)
+	}
+}
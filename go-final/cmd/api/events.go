@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	data "github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/events"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+)
+
+// eventBroker is the part of *events.Broker that the event stream uses,
+// so that tests can stream events without Postgres.
+type eventBroker interface {
+	Subscribe(userID int64) *events.Subscription
+	Unsubscribe(sub *events.Subscription)
+	Close()
+}
+
+const (
+	eventHeartbeatInterval = 15 * time.Second
+	eventReplayLimit       = 100
+)
+
+// publishEvent records an event for the user, or for everyone when userID is
+// zero, so that it is pushed to connected event streams on every instance.
+// Failing to publish never fails the request that triggered it.
+func (app *application) publishEvent(ctx context.Context, userID int64, eventType string, payload any) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	event := &data.Event{
+		UserID: userID,
+		Type:   eventType,
+		Data:   js,
+	}
+
+	err = app.models.Events.Insert(ctx, event)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"event_type": eventType,
+		})
+	}
+}
+
+func (app *application) eventStreamHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	// EventSource sends the ID of the last event it saw when reconnecting. The
+	// query string fallback is for clients that can't set headers.
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	var afterID int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid Last-Event-ID %q", lastEventID))
+			return
+		}
+		afterID = id
+	}
+
+	// The stream outlives the server's write timeout, so lift it for this
+	// connection. Heartbeats take care of detecting dead clients.
+	rc := http.NewResponseController(w)
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Subscribe before replaying so that nothing published in between is
+	// lost; duplicates are skipped by comparing IDs below.
+	sub := app.broker.Subscribe(user.ID)
+	defer app.broker.Unsubscribe(sub)
+
+	var replay []*data.Event
+	if lastEventID != "" {
+		replay, err = app.models.Events.GetSince(r.Context(), user.ID, afterID, eventReplayLimit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Ask clients to wait a few seconds before reconnecting, e.g. after a
+	// deploy closed the stream.
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	// Replay in pages until caught up, so that clients that were away for a
+	// while don't skip events. The stream can't report an error once it has
+	// started; closing it makes the client reconnect from the last event it
+	// got.
+	for {
+		for _, event := range replay {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			afterID = event.ID
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		if len(replay) < eventReplayLimit {
+			break
+		}
+
+		replay, err = app.models.Events.GetSince(r.Context(), user.ID, afterID, eventReplayLimit)
+		if err != nil {
+			app.logger.ErrorContext(r.Context(), "replaying events failed", jsonlog.Err(err))
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if event.ID <= afterID {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			afterID = event.ID
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+
+		case <-r.Context().Done():
+			return
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event *data.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/dbtest"
+	"github.com/sbeknur/go-final/internal/events"
+)
+
+// testBroker hands out subscriptions that never receive anything, so that
+// only replayed events are streamed.
+type testBroker struct {
+	mu   sync.Mutex
+	subs map[*events.Subscription]chan *data.Event
+}
+
+func (b *testBroker) Subscribe(userID int64) *events.Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan *data.Event)
+	sub := &events.Subscription{C: ch}
+	b.subs[sub] = ch
+	return sub
+}
+
+func (b *testBroker) Unsubscribe(sub *events.Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(ch)
+	}
+}
+
+func (b *testBroker) Close() {}
+
+// newEventStreamServer serves the event stream of user 1 from a stub
+// database holding events 1 to total.
+func newEventStreamServer(t *testing.T, total int64) (*httptest.Server, *dbtest.DB) {
+	t.Helper()
+
+	app := newTestApplication(t)
+	stub := useTestDB(t, app)
+
+	stub.Query("FROM events WHERE id > $1", func(args []any) (*dbtest.Rows, error) {
+		afterID, limit := args[0].(int64), int64(args[2].(int))
+		rows := &dbtest.Rows{Columns: []string{"id", "created_at", "user_id", "type", "data"}}
+		for id := afterID + 1; id <= total && id <= afterID+limit; id++ {
+			rows.Values = append(rows.Values, []any{id, time.Now(), int64(1), "notification", []byte(`{}`)})
+		}
+		return rows, nil
+	})
+
+	app.broker = &testBroker{subs: make(map[*events.Subscription]chan *data.Event)}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = app.contextSetUser(r, &data.User{ID: 1, Activated: true})
+		app.eventStreamHandler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, stub
+}
+
+// readEventIDs reads the stream until it has seen the event with the ID
+// last, and returns the IDs of all events it read.
+func readEventIDs(t *testing.T, body io.Reader, last int64) []int64 {
+	t.Helper()
+
+	var ids []int64
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "id: ")
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		if id == last {
+			break
+		}
+	}
+	return ids
+}
+
+func TestEventStreamReplaysEverythingMissed(t *testing.T) {
+	srv, stub := newEventStreamServer(t, 2*eventReplayLimit+50)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Last-Event-ID", "20")
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got status %d and type %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	ids := readEventIDs(t, res.Body, 2*eventReplayLimit+50)
+	if len(ids) != 2*eventReplayLimit+30 {
+		t.Fatalf("got %d events; want %d", len(ids), 2*eventReplayLimit+30)
+	}
+	for i, id := range ids {
+		if id != int64(21+i) {
+			t.Fatalf("event %d has ID %d; want %d", i, id, 21+i)
+		}
+	}
+
+	if n := stub.Ran("FROM events WHERE id > $1"); n != 3 {
+		t.Errorf("replayed in %d pages; want 3", n)
+	}
+}
+
+func TestEventStreamWithoutLastEventID(t *testing.T) {
+	srv, stub := newEventStreamServer(t, 10)
+
+	res, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	if err != nil || line != "retry: 3000\n" {
+		t.Fatalf("got %q, %v", line, err)
+	}
+	if n := stub.Ran("FROM events"); n != 0 {
+		t.Errorf("replayed %d pages to a new client; want none", n)
+	}
+}
+
+func TestEventStreamInvalidLastEventID(t *testing.T) {
+	srv, _ := newEventStreamServer(t, 10)
+
+	res, err := srv.Client().Get(srv.URL + "?last_event_id=-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d; want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
@@ -1,9 +1,18 @@
 package main
 
 import (
-	"fmt"
 	"io/ioutil"
 	"net/http"
+
+	"github.com/sbeknur/go-final/internal/jsonlog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	imageUploadDir = "files/image"
+	pdfUploadDir   = "files/pdf"
 )
 
 func (app *application) fileHandler(w http.ResponseWriter, r *http.Request) {
@@ -11,37 +20,54 @@ func (app *application) fileHandler(w http.ResponseWriter, r *http.Request) {
 
 	file, handler, err := r.FormFile("myfile")
 	if err != nil {
-		fmt.Println(err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	defer file.Close()
-	fmt.Println("File info")
-	fmt.Println("File name:", handler.Filename)
-	fmt.Println("File size:", handler.Size)
-	fmt.Println("File type:", handler.Header.Get("Content-Type"))
-
-	tempFile, err2 := ioutil.TempFile("files/image", "upload-*.jpg")
-	if err2 != nil {
-		fmt.Println(err2)
+
+	_, span := tracer.Start(r.Context(), "storage.Save", trace.WithAttributes(
+		attribute.String("file.name", handler.Filename),
+		attribute.Int64("file.size", handler.Size),
+	))
+	var saveErr error
+	defer func() {
+		if saveErr != nil {
+			span.RecordError(saveErr)
+			span.SetStatus(codes.Error, saveErr.Error())
+		}
+		span.End()
+	}()
+
+	tempFile, saveErr := ioutil.TempFile(imageUploadDir, "upload-*.jpg")
+	if saveErr != nil {
+		app.serverErrorResponse(w, r, saveErr)
 		return
 	}
 	defer tempFile.Close()
 
-	tempFile, err4 := ioutil.TempFile("files/pdf", "upload-*.pdf")
-	if err2 != nil {
-		fmt.Println(err4)
+	tempFile, saveErr = ioutil.TempFile(pdfUploadDir, "upload-*.pdf")
+	if saveErr != nil {
+		app.serverErrorResponse(w, r, saveErr)
 		return
 	}
 	defer tempFile.Close()
 
-	fileBytes, err3 := ioutil.ReadAll(file)
-	if err3 != nil {
-		fmt.Println(err2)
+	fileBytes, saveErr := ioutil.ReadAll(file)
+	if saveErr != nil {
+		app.serverErrorResponse(w, r, saveErr)
 		return
 	}
 
-	tempFile.Write(fileBytes)
+	_, saveErr = tempFile.Write(fileBytes)
+	if saveErr != nil {
+		app.serverErrorResponse(w, r, saveErr)
+		return
+	}
 
-	fmt.Println("File sended!")
+	app.logger.DebugContext(r.Context(), "file uploaded",
+		jsonlog.String("name", handler.Filename),
+		jsonlog.Int64("size", handler.Size),
+		jsonlog.String("type", handler.Header.Get("Content-Type")),
+	)
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/jsonlog"
+)
+
+// readinessCheckTimeout bounds each readiness check, so that one slow
+// dependency can't make the probe itself time out.
+const readinessCheckTimeout = 2 * time.Second
+
+func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+	env := envelope{
+		"status": "available",
+		"system_info": map[string]string{
+			"environment": app.config.env,
+			"version":     version,
+		},
+	}
+
+	err := app.writeJSON(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readinessHandler reports whether this instance should receive traffic. It
+// fails as soon as shutdown begins, so that load balancers stop routing to
+// the instance while it drains. The endpoint is public, so failures are
+// logged rather than returned.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]func(ctx context.Context) error{
+		"database":   app.checkDatabase,
+		"migrations": app.checkMigrations,
+	}
+	if app.config.mail.transport == "smtp" {
+		checks["smtp"] = app.checkSMTP
+	}
+
+	results := make(map[string]string, len(checks))
+	ready := !app.shuttingDown.Load()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range checks {
+		wg.Add(1)
+
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+			defer cancel()
+
+			err := check(ctx)
+			if err != nil {
+				app.logger.WarnContext(r.Context(), "readiness check failed",
+					jsonlog.String("check", name),
+					jsonlog.Err(err),
+				)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			results[name] = "ok"
+			if err != nil {
+				results[name] = "failed"
+				ready = false
+			}
+		}(name, check)
+	}
+
+	wg.Wait()
+
+	env := envelope{"status": "ready", "checks": results}
+	status := http.StatusOK
+
+	if !ready {
+		env["status"] = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	if app.shuttingDown.Load() {
+		env["status"] = "shutting down"
+	}
+
+	err := app.writeJSON(w, r, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) checkDatabase(ctx context.Context) error {
+	return app.db.PingContext(ctx)
+}
+
+func (app *application) checkMigrations(ctx context.Context) error {
+	current, dirty, err := app.migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	// A database that is ahead is fine: during a rolling deploy the new
+	// release migrates it while the old one is still serving.
+	switch latest := app.migrator.Latest(); {
+	case dirty:
+		return fmt.Errorf("migration %d failed and must be fixed manually", current)
+	case current < latest:
+		return fmt.Errorf("schema is at version %d, expected %d", current, latest)
+	}
+
+	return nil
+}
+
+func (app *application) checkSMTP(ctx context.Context) error {
+	addr := net.JoinHostPort(app.config.smtp.host, strconv.Itoa(app.config.smtp.port))
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("timed out connecting to %s", addr)
+		}
+		return err
+	}
+
+	return conn.Close()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -27,9 +28,17 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 
 type envelope map[string]any
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, header http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+// writeJSON writes compact JSON, unless the client asked for indented output
+// with ?pretty.
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data envelope, header http.Header) error {
+	var js []byte
+	var err error
 
+	if wantsPretty(r) {
+		js, err = json.MarshalIndent(data, "", "\t")
+	} else {
+		js, err = json.Marshal(data)
+	}
 	if err != nil {
 		return err
 	}
@@ -46,6 +55,23 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// wantsPretty reports whether the pretty query parameter is set. A bare
+// ?pretty counts as true.
+func wantsPretty(r *http.Request) bool {
+	qs := r.URL.Query()
+	if !qs.Has("pretty") {
+		return false
+	}
+
+	value := qs.Get("pretty")
+	if value == "" {
+		return true
+	}
+
+	pretty, err := strconv.ParseBool(value)
+	return err == nil && pretty
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
@@ -132,11 +158,33 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
-func (app *application) background(fn func()) {
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+// background runs fn in a goroutine that shutdown waits for. fn gets a copy
+// of ctx that isn't cancelled when the request finishes, so that its queries
+// and emails are still traced as part of the request that started it.
+func (app *application) background(ctx context.Context, fn func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+
 	app.wg.Add(1)
+	app.backgroundTasks.Add(1)
 
 	go func() {
 		defer app.wg.Done()
+		defer app.backgroundTasks.Add(-1)
 
 		defer func() {
 			if err := recover(); err != nil {
@@ -144,6 +192,6 @@ func (app *application) background(fn func()) {
 			}
 		}()
 
-		fn()
+		fn(ctx)
 	}()
 }
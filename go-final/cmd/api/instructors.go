@@ -28,7 +28,7 @@ func (app *application) createInstructorHandler(w http.ResponseWriter, r *http.R
 		Age:       input.Age,
 	}
 
-	err = app.models.Instructors.Insert(instructors)
+	err = app.models.Instructors.Insert(r.Context(), instructors)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -37,7 +37,7 @@ func (app *application) createInstructorHandler(w http.ResponseWriter, r *http.R
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/instructors/%d", instructors.ID))
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"instructors": instructors}, headers)
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"instructors": instructors}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -50,7 +50,7 @@ func (app *application) showInstructorHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	instructors, err := app.models.Instructors.Get(id)
+	instructors, err := app.models.Instructors.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -61,7 +61,7 @@ func (app *application) showInstructorHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"instructor": instructors}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"instructor": instructors}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -74,7 +74,7 @@ func (app *application) updateInstructorHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	instructor, err := app.models.Instructors.Get(id)
+	instructor, err := app.models.Instructors.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrInvalidRuntimeFormat):
@@ -109,7 +109,7 @@ func (app *application) updateInstructorHandler(w http.ResponseWriter, r *http.R
 		instructor.Age = *input.Age
 	}
 
-	err = app.models.Instructors.Update(instructor)
+	err = app.models.Instructors.Update(r.Context(), instructor)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -120,7 +120,7 @@ func (app *application) updateInstructorHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"instructor": instructor}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"instructor": instructor}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -133,7 +133,7 @@ func (app *application) deleteInstructorHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.models.Instructors.Delete(id)
+	err = app.models.Instructors.Delete(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -144,7 +144,7 @@ func (app *application) deleteInstructorHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "instructor successfully deleted"}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "instructor successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -173,13 +173,13 @@ func (app *application) listInstructorsHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	instructors, metadata, err := app.models.Instructors.GetAll(input.FirstName, input.LastName, input.Filters)
+	instructors, metadata, err := app.models.Instructors.GetAll(r.Context(), input.FirstName, input.LastName, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"instructors": instructors, "metadata": metadata}, nil)
+	err = app.writeCollection(w, r, "instructors", instructors, metadata)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	data "github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/validator"
+)
+
+func (app *application) createInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	inviter := app.contextGetUser(r)
+
+	invitation := &data.Invitation{
+		Email:     input.Email,
+		Role:      input.Role,
+		InvitedBy: &inviter.ID,
+		Expiry:    time.Now().Add(invitationTTL),
+	}
+
+	v := validator.New()
+
+	if data.ValidateInvitation(v, invitation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The token is created once, with the invitation, and the job only
+	// emails it, so that retries send the same token rather than invalidating
+	// one that may already have been delivered. The plaintext stays in the
+	// jobs table until the job is purged; it is worthless after the
+	// invitation expires or is accepted.
+	err = app.models.Invitations.Insert(r.Context(), invitation, func(ctx context.Context, tx *sql.Tx) error {
+		return app.jobs.EnqueueTx(ctx, tx, jobSendInvitationEmail, sendInvitationEmailArgs{
+			InvitationID: invitation.ID,
+			Token:        invitation.Plaintext,
+		})
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/invitations/%d", invitation.ID))
+
+	err = app.writeJSON(w, r, http.StatusAccepted, envelope{"invitation": invitation}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	invitation, err := app.models.Invitations.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"invitation": invitation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Invitations.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "invitation successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// invitationForToken returns the pending invitation for a registration. If
+// the token is invalid, or was sent to a different address, it adds an error
+// to v and returns nil.
+func (app *application) invitationForToken(r *http.Request, v *validator.Validator, token, email string) (*data.Invitation, error) {
+	if len(token) != 26 {
+		v.AddError("invite_token", "must be 26 bytes long")
+		return nil, nil
+	}
+
+	invitation, err := app.models.Invitations.GetForToken(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("invite_token", "invalid or expired invitation token")
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	if !strings.EqualFold(invitation.Email, email) {
+		v.AddError("email", "must be the address the invitation was sent to")
+		return nil, nil
+	}
+
+	return invitation, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/dbtest"
+)
+
+var inviteTokenRX = regexp.MustCompile(`"invite_token": "([A-Z2-7]{26})"`)
+
+func TestRegisterRejectsRole(t *testing.T) {
+	app := newTestApplication(t)
+	stub := useTestDB(t, app)
+
+	body := `{"name": "Mallory", "email": "mallory@example.com", "password": "pa55word1234", "role": "admin"}`
+	rr := httptest.NewRecorder()
+	app.registerUserHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body)))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusBadRequest)
+	}
+	if n := len(stub.Statements()); n != 0 {
+		t.Errorf("ran %d statements; want none", n)
+	}
+}
+
+func TestInviteAndRegister(t *testing.T) {
+	app := newTestApplication(t)
+	stub := useTestDB(t, app)
+	transport := useMemoryMailer(app)
+
+	var (
+		invitation []any
+		hash       []byte
+		accepted   bool
+		queued     [][]any
+		user       []any
+	)
+	columns := []string{"id", "created_at", "email", "role", "invited_by", "expiry", "accepted_at"}
+	invitationRow := func() []any {
+		var acceptedAt any
+		if accepted {
+			acceptedAt = time.Now()
+		}
+		return append(append([]any(nil), invitation...), acceptedAt)
+	}
+
+	stub.Query("INSERT INTO invitations", func(args []any) (*dbtest.Rows, error) {
+		hash = args[3].([]byte)
+		invitation = []any{int64(5), time.Now(), args[0], args[1], *args[2].(*int64), args[4]}
+		return &dbtest.Rows{Columns: []string{"id", "created_at"}, Values: [][]any{{int64(5), time.Now()}}}, nil
+	})
+	stub.Query("FROM invitations WHERE id = $1", func(args []any) (*dbtest.Rows, error) {
+		return &dbtest.Rows{Columns: columns, Values: [][]any{invitationRow()}}, nil
+	})
+	stub.Query("FROM invitations WHERE hash = $1", func(args []any) (*dbtest.Rows, error) {
+		rows := &dbtest.Rows{Columns: columns}
+		if bytes.Equal(args[0].([]byte), hash) && !accepted {
+			rows.Values = append(rows.Values, invitationRow())
+		}
+		return rows, nil
+	})
+	stub.Exec("UPDATE invitations", func(args []any) (int64, error) {
+		if accepted {
+			return 0, nil
+		}
+		accepted = true
+		return 1, nil
+	})
+	stub.Query("FROM users WHERE id = $1", func(args []any) (*dbtest.Rows, error) {
+		return &dbtest.Rows{
+			Columns: []string{"id", "created_at", "name", "email", "password_hash", "activated", "version", "role", "locale"},
+			Values:  [][]any{{int64(9), time.Now(), "Admin", "admin@example.com", []byte("hash"), true, int64(1), "admin", "en"}},
+		}, nil
+	})
+	stub.Query("INSERT INTO users", func(args []any) (*dbtest.Rows, error) {
+		user = args
+		return &dbtest.Rows{Columns: []string{"id", "created_at", "version"}, Values: [][]any{{int64(2), time.Now(), int64(1)}}}, nil
+	})
+	stub.Exec("INSERT INTO jobs", func(args []any) (int64, error) {
+		queued = append(queued, args)
+		return 1, nil
+	})
+	stub.Exec("INSERT INTO webhook_deliveries", func(args []any) (int64, error) { return 0, nil })
+
+	body := `{"email": "bob@example.com", "role": "admin"}`
+	r := httptest.NewRequest(http.MethodPost, "/v1/admin/invitations", strings.NewReader(body))
+	r = app.contextSetUser(r, &data.User{ID: 9, Role: "admin"})
+	rr := httptest.NewRecorder()
+	app.createInvitationHandler(rr, r)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("invite: got status %d; want %d: %s", rr.Code, http.StatusAccepted, rr.Body)
+	}
+
+	// The token is created once, with the invitation, and queued for the job
+	// to send; it isn't part of the response.
+	if len(queued) != 1 || queued[0][0] != jobSendInvitationEmail {
+		t.Fatalf("got queued jobs %v; want one %s", queued, jobSendInvitationEmail)
+	}
+	var args sendInvitationEmailArgs
+	if err := json.Unmarshal(queued[0][1].([]byte), &args); err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256([]byte(args.Token)); args.InvitationID != 5 || !bytes.Equal(sum[:], hash) {
+		t.Fatalf("got job args %+v; want the token of invitation 5", args)
+	}
+	if strings.Contains(rr.Body.String(), args.Token) {
+		t.Error("response contains the invitation token")
+	}
+
+	// Running the job again, as a retry would, sends the same token.
+	for i := 0; i < 2; i++ {
+		if err := app.sendInvitationEmailJob(context.Background(), args); err != nil {
+			t.Fatalf("invitation email job: %v", err)
+		}
+	}
+	messages := transport.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("sent %d emails; want 2", len(messages))
+	}
+	for _, msg := range messages {
+		match := inviteTokenRX.FindStringSubmatch(msg.PlainBody)
+		if msg.To != "bob@example.com" || match == nil || match[1] != args.Token {
+			t.Fatalf("got email to %s without the queued token:\n%s", msg.To, msg.PlainBody)
+		}
+	}
+
+	body = `{"name": "Bob", "email": "bob@example.com", "password": "pa55word1234", "invite_token": "` + args.Token + `"}`
+	rr = httptest.NewRecorder()
+	app.registerUserHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("register: got status %d; want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	// Invited users get the role of the invitation and are activated, so no
+	// welcome email is queued.
+	if user[3] != true || user[4] != "admin" {
+		t.Errorf("got user %v; want an activated admin", user)
+	}
+	if len(queued) != 1 {
+		t.Errorf("got queued jobs %v after an invited registration; want none", queued[1:])
+	}
+
+	// Once the invitation is accepted, the token can't be used again and the
+	// job no longer sends it.
+	body = strings.Replace(body, "bob@", "bob2@", 1)
+	rr = httptest.NewRecorder()
+	app.registerUserHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body)))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("second registration: got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+
+	if err := app.sendInvitationEmailJob(context.Background(), args); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(transport.Messages()); n != 2 {
+		t.Errorf("sent %d emails; want no more after the invitation was accepted", n)
+	}
+}
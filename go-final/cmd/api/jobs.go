@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/jobs"
+	"github.com/sbeknur/go-final/internal/mailer"
+)
+
+const (
+	jobSendWelcomeEmail      = "send_welcome_email"
+	jobSendDigest            = "send_digest"
+	jobSendInvitationEmail   = "send_invitation_email"
+	jobSendCourseUpdateEmail = "send_course_update_email"
+)
+
+const (
+	activationTokenTTL = 3 * 24 * time.Hour
+	invitationTTL      = 7 * 24 * time.Hour
+)
+
+type sendWelcomeEmailArgs struct {
+	UserID int64 `json:"user_id"`
+}
+
+type sendDigestArgs struct {
+	UserID int64 `json:"user_id"`
+}
+
+type sendInvitationEmailArgs struct {
+	InvitationID int64  `json:"invitation_id"`
+	Token        string `json:"token"`
+}
+
+// sendCourseUpdateEmailArgs carries the title the course had when it was
+// updated, the same one as in the inbox notification.
+type sendCourseUpdateEmailArgs struct {
+	UserID      int64  `json:"user_id"`
+	CourseID    int64  `json:"course_id"`
+	CourseTitle string `json:"course_title"`
+}
+
+func (app *application) registerJobs() {
+	jobs.Register(app.jobs, jobSendWelcomeEmail, app.sendWelcomeEmailJob)
+	jobs.Register(app.jobs, jobSendDigest, app.sendDigestJob)
+	jobs.Register(app.jobs, jobSendInvitationEmail, app.sendInvitationEmailJob)
+	jobs.Register(app.jobs, jobSendCourseUpdateEmail, app.sendCourseUpdateEmailJob)
+}
+
+// sendWelcomeEmailJob creates the activation token itself rather than
+// receiving it as an argument, so plaintext tokens never sit in the jobs
+// table. A retry simply issues a fresh token.
+func (app *application) sendWelcomeEmailJob(ctx context.Context, args sendWelcomeEmailArgs) error {
+	user, err := app.models.Users.Get(ctx, args.UserID)
+	if err != nil {
+		// The user may have been deleted since; there is nobody to email.
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if user.Activated {
+		return nil
+	}
+
+	token, err := app.models.Tokens.New(ctx, user.ID, activationTokenTTL, data.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	templateData := map[string]any{
+		"activationToken":  token.Plaintext,
+		"activationTTL":    activationTokenTTL,
+		"activationExpiry": token.Expiry,
+		"userID":           user.ID,
+	}
+
+	recipient := mailer.Recipient{UserID: user.ID, Email: user.Email, Locale: user.Locale}
+	return app.mailer.Send(ctx, recipient, "user_welcome.tmpl", templateData)
+}
+
+func (app *application) sendDigestJob(ctx context.Context, args sendDigestArgs) error {
+	user, err := app.models.Users.Get(ctx, args.UserID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	filters := data.Filters{
+		Page:         1,
+		PageSize:     10,
+		Sort:         "-created_at",
+		SortSafeList: []string{"-created_at"},
+	}
+
+	notifications, metadata, err := app.models.Notifications.GetAllForUser(ctx, user.ID, true, filters)
+	if err != nil {
+		return err
+	}
+
+	// Everything may have been read between queueing and running the job.
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	titles := make([]string, len(notifications))
+	for i, notification := range notifications {
+		titles[i] = notification.Title
+	}
+
+	templateData := map[string]any{
+		"userName":    user.Name,
+		"unreadCount": metadata.TotalRecords,
+		"titles":      titles,
+	}
+
+	recipient := mailer.Recipient{UserID: user.ID, Email: user.Email, Locale: user.Locale}
+	return app.mailer.Send(ctx, recipient, "digest.tmpl", templateData)
+}
+
+func (app *application) sendCourseUpdateEmailJob(ctx context.Context, args sendCourseUpdateEmailArgs) error {
+	user, err := app.models.Users.Get(ctx, args.UserID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	templateData := map[string]any{
+		"userName":    user.Name,
+		"courseID":    args.CourseID,
+		"courseTitle": args.CourseTitle,
+	}
+
+	recipient := mailer.Recipient{UserID: user.ID, Email: user.Email, Locale: user.Locale}
+	return app.mailer.Send(ctx, recipient, "course_update.tmpl", templateData)
+}
+
+// sendInvitationEmailJob sends the token created with the invitation.
+func (app *application) sendInvitationEmailJob(ctx context.Context, args sendInvitationEmailArgs) error {
+	invitation, err := app.models.Invitations.Get(ctx, args.InvitationID)
+	if err != nil {
+		// The invitation may have been revoked since.
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Or already accepted, or expired while the job was retried.
+	if invitation.AcceptedAt != nil || time.Now().After(invitation.Expiry) {
+		return nil
+	}
+
+	inviterName := ""
+	if invitation.InvitedBy != nil {
+		inviter, err := app.models.Users.Get(ctx, *invitation.InvitedBy)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			return err
+		}
+		if inviter != nil {
+			inviterName = inviter.Name
+		}
+	}
+
+	templateData := map[string]any{
+		"inviterName":      inviterName,
+		"role":             invitation.Role,
+		"email":            invitation.Email,
+		"invitationToken":  args.Token,
+		"invitationTTL":    invitationTTL,
+		"invitationExpiry": invitation.Expiry,
+	}
+
+	recipient := mailer.Recipient{Email: invitation.Email}
+	return app.mailer.Send(ctx, recipient, "invitation.tmpl", templateData)
+}
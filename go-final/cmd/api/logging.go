@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/sbeknur/go-final/internal/jsonlog"
+	"github.com/sbeknur/go-final/internal/validator"
+)
+
+func (app *application) showLoggingHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, r, http.StatusOK, envelope{"logging": app.loggingSettings()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateLoggingHandler changes the log level and sampling without a restart.
+// The changes are lost when the process exits.
+func (app *application) updateLoggingHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Level    *jsonlog.Level `json:"level"`
+		Sampling map[string]int `json:"sampling"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	for message, perSecond := range input.Sampling {
+		v.Check(message != "", "sampling", "must not contain an empty message")
+		v.Check(perSecond >= 0, "sampling", "must not contain negative limits")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Level != nil {
+		previous := app.logger.Level()
+		logChange := func() {
+			app.logger.WarnContext(r.Context(), "log level changed",
+				jsonlog.String("from", previous.String()),
+				jsonlog.String("to", input.Level.String()),
+			)
+		}
+
+		// Log the change while the more verbose of the two levels is in
+		// effect, so that raising the level to ERROR doesn't hide it.
+		if *input.Level > previous {
+			logChange()
+			app.logger.SetLevel(*input.Level)
+		} else {
+			app.logger.SetLevel(*input.Level)
+			logChange()
+		}
+	}
+
+	for message, perSecond := range input.Sampling {
+		app.logger.SetSampling(message, perSecond)
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"logging": app.loggingSettings()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) loggingSettings() map[string]any {
+	return map[string]any{
+		"level":    app.logger.Level(),
+		"sampling": app.logger.Sampling(),
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sbeknur/go-final/internal/jsonlog"
+)
+
+func TestUpdateLoggingLogsLevelChange(t *testing.T) {
+	tests := []struct {
+		from, to jsonlog.Level
+	}{
+		{jsonlog.LevelInfo, jsonlog.LevelError},
+		{jsonlog.LevelWarn, jsonlog.LevelOff},
+		{jsonlog.LevelError, jsonlog.LevelDebug},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from.String()+" to "+tt.to.String(), func(t *testing.T) {
+			var out bytes.Buffer
+			app := newTestApplication(t)
+			app.logger = jsonlog.New(&out, tt.from)
+
+			body := `{"level": "` + tt.to.String() + `"}`
+			rr := httptest.NewRecorder()
+			app.updateLoggingHandler(rr, httptest.NewRequest(http.MethodPut, "/v1/admin/logging", strings.NewReader(body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusOK, rr.Body)
+			}
+
+			if app.logger.Level() != tt.to {
+				t.Errorf("got level %s; want %s", app.logger.Level(), tt.to)
+			}
+			if !strings.Contains(out.String(), `"log level changed"`) {
+				t.Errorf("level change wasn't logged: %q", out.String())
+			}
+		})
+	}
+}
@@ -1,19 +1,195 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/felixge/httpsnoop"
+	"github.com/julienschmidt/httprouter"
 	data "github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+	"github.com/sbeknur/go-final/internal/ratelimit"
 	"github.com/sbeknur/go-final/internal/validator"
-	"golang.org/x/time/rate"
 )
 
+// requestIDRX limits the request IDs we accept from clients, so they can't
+// inject arbitrary text into logs and response headers.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// logRequest assigns every request an ID, reusing a valid X-Request-ID sent by
+// the client or a proxy, and logs the request once it has completed.
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(requestID) {
+			requestID = generateRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		r = app.contextSetRequestID(r, requestID)
+
+		metrics := httpsnoop.CaptureMetrics(next, w, r)
+
+		fields := []jsonlog.Field{
+			jsonlog.String("request_method", r.Method),
+			jsonlog.String("request_path", r.URL.Path),
+			jsonlog.Int("status", metrics.Code),
+			jsonlog.Int64("bytes", metrics.Written),
+			jsonlog.Duration("duration", metrics.Duration),
+			jsonlog.String("ip", app.clientIP(r)),
+		}
+
+		state := r.Context().Value(requestStateContextKey).(*requestState)
+		if state.user != nil && !state.user.IsAnonymous() {
+			fields = append(fields, jsonlog.Int64("user_id", state.user.ID))
+		}
+
+		app.logger.InfoContext(r.Context(), "request completed", fields...)
+	})
+}
+
+// recordMetrics counts requests and their latency by the route pattern they
+// matched, such as /v1/courses/:id.
+func (app *application) recordMetrics(router *httprouter.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics := httpsnoop.CaptureMetrics(next, w, r)
+		app.metrics.ObserveRequest(r.Method, matchedRoute(router, r), metrics.Code, metrics.Duration)
+	})
+}
+
+// matchedRoute returns the pattern of the route r matches. Requests that
+// match no route are grouped together so that scanners can't create a metric
+// series or span name per path.
+func matchedRoute(router *httprouter.Router, r *http.Request) string {
+	handle, params, _ := router.Lookup(r.Method, r.URL.Path)
+	if handle == nil {
+		return "unmatched"
+	}
+	return routePattern(r.URL.Path, params)
+}
+
+// routePattern rebuilds the pattern a path was routed by, replacing parameter
+// values with their names. httprouter returns the parameters in the order
+// they appear in the path.
+func routePattern(path string, params httprouter.Params) string {
+	segments := strings.Split(path, "/")
+
+	i := 0
+	for _, p := range params {
+		for ; i < len(segments); i++ {
+			if segments[i] == p.Value {
+				segments[i] = ":" + p.Key
+				i++
+				break
+			}
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func generateRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// clientIP returns the address of the client that sent the request. Behind
+// one of the -trusted-proxies it is taken from X-Forwarded-For, skipping
+// addresses from the right for as long as they belong to trusted proxies;
+// anything to the left of that could have been set by the client.
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if !app.isTrustedProxy(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		ip = hop
+		if !app.isTrustedProxy(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (app *application) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTTPS reports whether the client connected over TLS, either to us or to
+// a trusted proxy in front of us.
+func (app *application) isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	return app.isTrustedProxy(ip) && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// secureHeaders sets headers that harden browsers against misuse of API
+// responses. Nothing the API serves is meant to be rendered as a page, so the
+// content security policy forbids everything, which also keeps uploaded files
+// from running scripts if they are ever served back.
+func (app *application) secureHeaders(next http.Handler) http.Handler {
+	hsts := fmt.Sprintf("max-age=%d; includeSubDomains", int(app.config.tls.hstsMaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'; sandbox")
+
+		// Browsers ignore HSTS received over plain HTTP.
+		if app.config.tls.hstsMaxAge > 0 && app.isHTTPS(r) {
+			w.Header().Set("Strict-Transport-Security", hsts)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -26,56 +202,131 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) rateLimit(next http.Handler) http.Handler {
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
+// signInRoute is rate limited with the strict sign-in policy, since it can
+// be used to guess passwords.
+const signInRoute = http.MethodPost + " /v1/tokens/authentication"
+
+// limiterPolicies are the rate limit policies: anonymous clients and sign-in
+// attempts are limited per IP, authenticated users per user, and failed
+// bearer tokens per IP in a bucket of their own, so that neither a client's
+// sign-ins nor its bad tokens can lock out its valid ones.
+type limiterPolicies struct {
+	anonymous ratelimit.Policy
+	user      ratelimit.Policy
+	signIn    ratelimit.Policy
+	token     ratelimit.Policy
+}
+
+func (app *application) limiterPolicies() limiterPolicies {
+	return limiterPolicies{
+		anonymous: ratelimit.Policy{Name: "ip", Rate: app.config.limiter.rps, Burst: app.config.limiter.burst},
+		user:      ratelimit.Policy{Name: "user", Rate: app.config.limiter.userRPS, Burst: app.config.limiter.userBurst},
+		signIn:    ratelimit.Policy{Name: "auth", Rate: app.config.limiter.authRPS, Burst: app.config.limiter.authBurst},
+		token:     ratelimit.Policy{Name: "token", Rate: app.config.limiter.tokenRPS, Burst: app.config.limiter.tokenBurst},
 	}
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
+}
 
-	go func() {
-		for {
-			time.Sleep(time.Minute)
+// rateLimit limits sign-in per IP, and all other requests per user if the
+// client is authenticated or per IP if not. It runs after authenticate so
+// that the user is known; requests that fail authentication are limited by
+// authenticate itself. If the limiter fails, for example because the
+// database is down, requests are let through.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	policies := app.limiterPolicies()
 
-			mu.Lock()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.limiter.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
+		policy, key := policies.anonymous, app.clientIP(r)
+		switch u := app.contextGetUser(r); {
+		case r.Method+" "+r.URL.Path == signInRoute:
+			policy = policies.signIn
+		case !u.IsAnonymous():
+			policy, key = policies.user, strconv.FormatInt(u.ID, 10)
+		}
 
-			mu.Unlock()
+		result, err := app.limiter.Allow(r.Context(), key, policy)
+		if err != nil {
+			app.logger.ErrorContext(r.Context(), "rate limiter failed", jsonlog.Err(err))
+			next.ServeHTTP(w, r)
+			return
 		}
-	}()
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.limiter.enabled {
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
-			if err != nil {
-				app.serverErrorResponse(w, r, err)
-				return
-			}
-			mu.Lock()
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
-				}
-			}
-			clients[ip].lastSeen = time.Now()
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
-				app.rateLimitExceededResponse(w, r)
-				return
-			}
-			mu.Unlock()
+
+		if !app.applyRateLimit(w, r, policy, result) {
+			return
 		}
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+// applyRateLimit sets the rate limit headers for result and, if the request
+// isn't allowed, sends the 429 response. It reports whether the request may
+// go ahead.
+func (app *application) applyRateLimit(w http.ResponseWriter, r *http.Request, policy ratelimit.Policy, result ratelimit.Result) bool {
+	// Headers as in the IETF RateLimit header fields draft.
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Burst, ceilSeconds(policy.Window())))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		app.metrics.RateLimited()
+		app.rateLimitExceededResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// allowAuthAttempt checks, without counting it, whether the client still
+// has failed token attempts left. Clients that have used them up are turned
+// away before their token is looked up.
+func (app *application) allowAuthAttempt(w http.ResponseWriter, r *http.Request) bool {
+	if !app.config.limiter.enabled {
+		return true
+	}
+
+	token := app.limiterPolicies().token
+
+	result, err := app.limiter.Peek(r.Context(), app.clientIP(r), token)
+	if err != nil {
+		app.logger.ErrorContext(r.Context(), "rate limiter failed", jsonlog.Err(err))
+		return true
+	}
+
+	if result.Allowed {
+		return true
+	}
+	return app.applyRateLimit(w, r, token, result)
+}
+
+// authenticationFailed counts a bad Authorization header against the
+// client's IP under the token policy, so that guessing tokens is slow, and
+// then sends the 401 response. Valid tokens are never counted.
+func (app *application) authenticationFailed(w http.ResponseWriter, r *http.Request) {
+	if app.config.limiter.enabled {
+		token := app.limiterPolicies().token
+
+		result, err := app.limiter.Allow(r.Context(), app.clientIP(r), token)
+		if err != nil {
+			app.logger.ErrorContext(r.Context(), "rate limiter failed", jsonlog.Err(err))
+		} else if !app.applyRateLimit(w, r, token, result) {
+			return
+		}
+	}
+
+	app.invalidAuthenticationTokenResponse(w, r)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -87,9 +338,13 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		if !app.allowAuthAttempt(w, r) {
+			return
+		}
+
 		headerParts := strings.Split(authorizationHeader, " ")
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.authenticationFailed(w, r)
 			return
 		}
 
@@ -98,15 +353,15 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		v := validator.New()
 
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.authenticationFailed(w, r)
 			return
 		}
 
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
-				app.invalidAuthenticationTokenResponse(w, r)
+				app.authenticationFailed(w, r)
 			default:
 				app.serverErrorResponse(w, r, err)
 			}
@@ -135,11 +390,19 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 			app.inactiveAccountResponse(w, r)
 			return
 		}
+		// Call the next handler in the chain.
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdminUser only lets activated users with the admin role through.
+func (app *application) requireAdminUser(next http.HandlerFunc) http.HandlerFunc {
+	return app.requireActivatedUser(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
 		if user.Role != "admin" {
 			app.notAdminResponse(w, r)
 			return
 		}
-		// Call the next handler in the chain.
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/dbtest"
+	"github.com/sbeknur/go-final/internal/ratelimit"
+)
+
+const validTestToken = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// newRateLimitedApplication returns an application with the rate limiter
+// on, small buckets and a database that knows validTestToken.
+func newRateLimitedApplication(t *testing.T) (*application, http.Handler) {
+	t.Helper()
+
+	app := newTestApplication(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.rps, app.config.limiter.burst = 0.001, 10
+	app.config.limiter.userRPS, app.config.limiter.userBurst = 0.001, 10
+	app.config.limiter.authRPS, app.config.limiter.authBurst = 0.001, 2
+	app.config.limiter.tokenRPS, app.config.limiter.tokenBurst = 0.001, 2
+	app.limiter = ratelimit.NewMemory()
+
+	db, stub := dbtest.New(t)
+	stub.Query("INNER JOIN tokens", func(args []any) (*dbtest.Rows, error) {
+		rows := &dbtest.Rows{Columns: []string{"id", "created_at", "name", "email", "password_hash", "activated", "version", "role", "locale"}}
+		hash := sha256.Sum256([]byte(validTestToken))
+		if bytes.Equal(args[0].([]byte), hash[:]) && args[1] == data.ScopeAuthentication {
+			rows.Values = append(rows.Values, []any{int64(1), time.Now(), "Alice", "alice@example.com", []byte("hash"), true, int64(1), "user", "en"})
+		}
+		return rows, nil
+	})
+	app.models = data.NewModels(db)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	return app, app.authenticate(app.rateLimit(ok))
+}
+
+func serve(handler http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	return rr
+}
+
+func TestValidTokenAfterSignInLimit(t *testing.T) {
+	_, handler := newRateLimitedApplication(t)
+
+	for i := 0; i < 2; i++ {
+		if rr := serve(handler, http.MethodPost, "/v1/tokens/authentication", ""); rr.Code != http.StatusOK {
+			t.Fatalf("sign-in %d: got status %d; want %d", i, rr.Code, http.StatusOK)
+		}
+	}
+	if rr := serve(handler, http.MethodPost, "/v1/tokens/authentication", ""); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("sign-in over the limit: got status %d; want %d", rr.Code, http.StatusTooManyRequests)
+	}
+
+	if rr := serve(handler, http.MethodGet, "/v1/courses", validTestToken); rr.Code != http.StatusOK {
+		t.Errorf("valid token: got status %d; want %d", rr.Code, http.StatusOK)
+	}
+	if rr := serve(handler, http.MethodPost, "/v1/users", ""); rr.Code != http.StatusOK {
+		t.Errorf("registration: got status %d; want %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestFailedTokenLimit(t *testing.T) {
+	_, handler := newRateLimitedApplication(t)
+
+	for i := 0; i < 2; i++ {
+		if rr := serve(handler, http.MethodGet, "/v1/courses", strings.Repeat("X", 26)); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("bad token %d: got status %d; want %d", i, rr.Code, http.StatusUnauthorized)
+		}
+	}
+	if rr := serve(handler, http.MethodGet, "/v1/courses", strings.Repeat("X", 26)); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("bad token over the limit: got status %d; want %d", rr.Code, http.StatusTooManyRequests)
+	}
+
+	// Once the failed token bucket is used up, every token from that IP is
+	// turned away until it refills, but sign-in still works.
+	if rr := serve(handler, http.MethodGet, "/v1/courses", validTestToken); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("valid token after the limit: got status %d; want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if rr := serve(handler, http.MethodPost, "/v1/tokens/authentication", ""); rr.Code != http.StatusOK {
+		t.Errorf("sign-in: got status %d; want %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestValidTokensAreNotCounted(t *testing.T) {
+	_, handler := newRateLimitedApplication(t)
+
+	for i := 0; i < 5; i++ {
+		if rr := serve(handler, http.MethodGet, "/v1/courses", validTestToken); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d; want %d", i, rr.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	app := newTestApplication(t)
+
+	var err error
+	app.trustedProxies, err = parseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "198.51.100.7:1234", nil, "198.51.100.7"},
+		{"untrusted peer", "198.51.100.7:1234", []string{"203.0.113.5"}, "198.51.100.7"},
+		{"trusted proxy", "192.0.2.1:1234", []string{"203.0.113.5"}, "203.0.113.5"},
+		{"spoofed hops", "192.0.2.1:1234", []string{"1.1.1.1, 203.0.113.5"}, "203.0.113.5"},
+		{"proxy chain", "10.0.0.2:1234", []string{"203.0.113.5, 10.1.2.3", "10.0.0.9"}, "203.0.113.5"},
+		{"only proxies", "10.0.0.2:1234", []string{"10.1.2.3"}, "10.1.2.3"},
+		{"garbage hop", "192.0.2.1:1234", []string{"203.0.113.5, unknown"}, "192.0.2.1"},
+		{"no header", "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"mapped proxy", "[::ffff:192.0.2.1]:1234", []string{"203.0.113.5"}, "203.0.113.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/courses", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := app.clientIP(r); got != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/sbeknur/go-final/internal/jsonlog"
+	"github.com/sbeknur/go-final/internal/migrate"
+	"github.com/sbeknur/go-final/migrations"
+)
+
+const migrateUsage = "usage: api [flags] migrate up|down [N]|status|force N"
+
+// runMigrate implements the migrate subcommand. Output is plain text rather
+// than JSON log lines, since it is meant to be read by whoever ran it.
+func runMigrate(cfg config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	command := args[0]
+	n := int64(-1)
+
+	switch {
+	case (command == "up" || command == "status") && len(args) == 1:
+	case command == "down" && len(args) == 1:
+		n = 1
+	case (command == "down" || command == "force") && len(args) == 2:
+		var err error
+		n, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil || n < 0 || (command == "down" && n == 0) {
+			return fmt.Errorf("invalid argument %q\n%s", args[1], migrateUsage)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if errors.Is(err, migrate.ErrNoChange) {
+			fmt.Println("no pending migrations")
+			return nil
+		}
+		return err
+
+	case "down":
+		reverted, err := migrator.Down(ctx, int(n))
+		for _, m := range reverted {
+			fmt.Printf("reverted %d_%s\n", m.Version, m.Name)
+		}
+		if errors.Is(err, migrate.ErrNoChange) {
+			fmt.Println("no migrations to revert")
+			return nil
+		}
+		return err
+
+	case "force":
+		err := migrator.Force(ctx, n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("forced version %d\n", n)
+		return nil
+
+	default:
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("version: %d\n", status.Version)
+		fmt.Printf("latest:  %d\n", status.Latest)
+		fmt.Printf("dirty:   %t\n", status.Dirty)
+		for _, m := range status.Pending {
+			fmt.Printf("pending: %d_%s\n", m.Version, m.Name)
+		}
+		return nil
+	}
+}
+
+// migrateOnStart applies pending migrations before the server starts. It is
+// opt-in, since usually a release step rather than every instance should own
+// schema changes.
+func (app *application) migrateOnStart(ctx context.Context) error {
+	applied, err := app.migrator.Up(ctx)
+	for _, m := range applied {
+		app.logger.Info("applied migration",
+			jsonlog.Int64("version", m.Version),
+			jsonlog.String("name", m.Name),
+		)
+	}
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
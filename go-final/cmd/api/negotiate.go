@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Representations of collections, in order of preference when the client
+// accepts several equally.
+const (
+	mediaJSON    = "application/json"
+	mediaNDJSON  = "application/x-ndjson"
+	mediaCSV     = "text/csv"
+	mediaMsgpack = "application/msgpack"
+)
+
+var collectionMediaTypes = []string{mediaJSON, mediaNDJSON, mediaCSV, mediaMsgpack}
+
+// mediaTypeAliases maps other names in use for a media type to ours.
+var mediaTypeAliases = map[string]string{
+	"application/x-msgpack":   mediaMsgpack,
+	"application/vnd.msgpack": mediaMsgpack,
+	"application/ndjson":      mediaNDJSON,
+	"application/jsonl":       mediaNDJSON,
+}
+
+// qualityItem is one entry of an Accept or Accept-Encoding header.
+type qualityItem struct {
+	value string
+	q     float64
+}
+
+// parseQualityList parses a header such as "text/csv;q=0.9, */*;q=0.1".
+// Parameters other than q are ignored, and entries without q get 1.
+func parseQualityList(header string) []qualityItem {
+	var items []qualityItem
+
+	for _, entry := range strings.Split(header, ",") {
+		parts := strings.Split(entry, ";")
+
+		item := qualityItem{value: strings.ToLower(strings.TrimSpace(parts[0])), q: 1}
+		if item.value == "" {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				q, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					q = 0
+				}
+				item.q = q
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// negotiateMediaType returns the offer the Accept header prefers, or "" if
+// it accepts none of them. Offers are listed in order of preference, and the
+// first one is chosen if there is no Accept header.
+func negotiateMediaType(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	ranges := parseQualityList(accept)
+	for i := range ranges {
+		if alias, ok := mediaTypeAliases[ranges[i].value]; ok {
+			ranges[i].value = alias
+		}
+	}
+
+	best, bestQ := "", 0.0
+
+	for _, offer := range offers {
+		offerType, _, _ := strings.Cut(offer, "/")
+
+		// The most specific matching range decides the offer's quality.
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			s := -1
+			switch {
+			case r.value == offer:
+				s = 2
+			case r.value == offerType+"/*":
+				s = 1
+			case r.value == "*/*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// writeCollection writes a page of a collection as JSON, NDJSON, CSV or
+// MessagePack, depending on the Accept header. JSON and MessagePack use the
+// usual envelope. NDJSON and CSV only contain the items, so the pagination
+// metadata is sent in the Link and X-Total-Count headers, which are set for
+// every representation. items must be a slice of structs or struct pointers.
+func (app *application) writeCollection(w http.ResponseWriter, r *http.Request, name string, items any, metadata data.Metadata) error {
+	w.Header().Add("Vary", "Accept")
+
+	mediaType := negotiateMediaType(r.Header.Get("Accept"), collectionMediaTypes)
+	if mediaType == "" {
+		app.notAcceptableResponse(w, r, collectionMediaTypes)
+		return nil
+	}
+
+	setPaginationHeaders(w, r, metadata)
+
+	env := envelope{name: items, "metadata": metadata}
+
+	var body []byte
+	var err error
+
+	switch mediaType {
+	case mediaNDJSON:
+		body, err = encodeNDJSON(items)
+	case mediaCSV:
+		mediaType += "; charset=utf-8"
+		body, err = encodeCSV(items)
+	case mediaMsgpack:
+		body, err = encodeMsgpack(env)
+	default:
+		return app.writeJSON(w, r, http.StatusOK, env, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(http.StatusOK)
+
+	// The status has been sent, so a failed write can only be logged. It
+	// usually means the client went away.
+	_, err = w.Write(body)
+	if err != nil {
+		app.logger.WarnContext(r.Context(), "writing response failed", jsonlog.Err(err))
+	}
+
+	return nil
+}
+
+// setPaginationHeaders adds links to the first, previous, next and last pages
+// in the form of RFC 8288, along with the total number of records.
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, metadata data.Metadata) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(metadata.TotalRecords))
+
+	if metadata.TotalRecords == 0 {
+		return
+	}
+
+	link := func(page int, rel string) string {
+		qs := r.URL.Query()
+		qs.Set("page", strconv.Itoa(page))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, qs.Encode(), rel)
+	}
+
+	links := []string{link(metadata.FirstPage, "first")}
+	if metadata.CurrentPage > metadata.FirstPage {
+		links = append(links, link(metadata.CurrentPage-1, "prev"))
+	}
+	if metadata.CurrentPage < metadata.LastPage {
+		links = append(links, link(metadata.CurrentPage+1, "next"))
+	}
+	links = append(links, link(metadata.LastPage, "last"))
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+func encodeNDJSON(items any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	v := reflect.ValueOf(items)
+	for i := 0; i < v.Len(); i++ {
+		err := enc.Encode(v.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encodeCSV writes one row per item, with a column for each field that is in
+// the item's JSON representation, named the same. Each cell holds the
+// field's JSON value, except that strings are unquoted and null is empty, so
+// lists and objects stay readable as JSON.
+func encodeCSV(items any) ([]byte, error) {
+	v := reflect.ValueOf(items)
+
+	elemType := v.Type().Elem()
+	if elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("encodeCSV: unsupported item type %s", v.Type().Elem())
+	}
+
+	var header []string
+	var fields []int
+
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+
+	err := cw.Write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		item := reflect.Indirect(v.Index(i))
+
+		row := make([]string, len(fields))
+		for j, index := range fields {
+			row[j], err = csvCell(item.Field(index).Interface())
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = cw.Write(row)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// csvCell formats a value for a CSV cell. Spreadsheets evaluate cells that
+// start with =, +, - or @, or with a tab or carriage return before one of
+// those, as formulas, so strings that do are prefixed with an apostrophe,
+// which makes them text. Numbers are left alone, since they
+// aren't read as formulas and -1 has to stay a number.
+func csvCell(value any) (string, error) {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case string(js) == "null":
+		return "", nil
+	case js[0] == '"':
+		var s string
+		err = json.Unmarshal(js, &s)
+		if err != nil {
+			return "", err
+		}
+		if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+			s = "'" + s
+		}
+		return s, nil
+	default:
+		return string(js), nil
+	}
+}
+
+// encodeMsgpack encodes env the same way as it would be encoded as JSON, so
+// that custom JSON encodings such as the runtime's are kept, by way of a
+// round trip through JSON.
+func encodeMsgpack(env envelope) ([]byte, error) {
+	js, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var value any
+	err = dec.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	return msgpack.Marshal(fromJSONNumbers(value))
+}
+
+// fromJSONNumbers replaces the json.Numbers in a decoded value with integers
+// where possible, and floats otherwise, so that IDs keep their precision.
+func fromJSONNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, item := range v {
+			v[key] = fromJSONNumbers(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = fromJSONNumbers(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", mediaJSON},
+		{"*/*", mediaJSON},
+		{"text/csv", mediaCSV},
+		{"application/*", mediaJSON},
+		{"text/*", mediaCSV},
+		{"application/x-msgpack", mediaMsgpack},
+		{"application/jsonl", mediaNDJSON},
+		{"text/csv;q=0.5, application/x-ndjson;q=0.8", mediaNDJSON},
+		{"application/json;q=0.1, text/csv", mediaCSV},
+		{"*/*;q=0.1, text/csv;q=0", mediaJSON},
+		{"application/*, application/json;q=0", mediaNDJSON},
+		{"TEXT/CSV", mediaCSV},
+		{"text/csv;q=oops, application/json;q=0.2", mediaJSON},
+		{"text/html", ""},
+		{"application/json;q=0", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			got := negotiateMediaType(tt.accept, collectionMediaTypes)
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"string", "Go", "Go"},
+		{"quotes", `say "hi"`, `say "hi"`},
+		{"empty", "", ""},
+		{"nil", nil, ""},
+		{"nil slice", []string(nil), ""},
+		{"number", 42, "42"},
+		{"negative number", -1, "-1"},
+		{"bool", true, "true"},
+		{"list", []string{"a", "b"}, `["a","b"]`},
+		{"formula", "=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"plus", "+1", "'+1"},
+		{"minus", "-2+3", "'-2+3"},
+		{"at", "@SUM(A1)", "'@SUM(A1)"},
+		{"tab", "\t=1", "'\t=1"},
+		{"equals later", "a=b", "a=b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := csvCell(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type testItem struct {
+	ID      int64    `json:"id"`
+	Name    string   `json:"name"`
+	Tags    []string `json:"tags,omitempty"`
+	Secret  string   `json:"-"`
+	private string
+}
+
+var testItems = []*testItem{
+	{ID: 1, Name: "first", Tags: []string{"a"}, Secret: "x"},
+	{ID: 2, Name: "=second", private: "y"},
+}
+
+func TestWriteCollection(t *testing.T) {
+	app := newTestApplication(t)
+	metadata := data.Metadata{CurrentPage: 2, PageSize: 2, FirstPage: 1, LastPage: 3, TotalRecords: 6}
+
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{
+			accept:      "",
+			status:      http.StatusOK,
+			contentType: "application/json",
+		},
+		{
+			accept:      "application/x-ndjson",
+			status:      http.StatusOK,
+			contentType: mediaNDJSON,
+			body:        "{\"id\":1,\"name\":\"first\",\"tags\":[\"a\"]}\n{\"id\":2,\"name\":\"=second\"}\n",
+		},
+		{
+			accept:      "text/csv",
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body:        "id,name,tags\n1,first,\"[\"\"a\"\"]\"\n2,'=second,\n",
+		},
+		{
+			accept:      "application/msgpack",
+			status:      http.StatusOK,
+			contentType: mediaMsgpack,
+		},
+		{
+			accept: "text/html",
+			status: http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/items?page=2&page_size=2", nil)
+			r.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+
+			err := app.writeCollection(rr, r, "items", testItems, metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rr.Code != tt.status {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.status)
+			}
+			if rr.Header().Get("Vary") != "Accept" {
+				t.Errorf("got Vary %q; want Accept", rr.Header().Get("Vary"))
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			if got := rr.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("got Content-Type %q; want %q", got, tt.contentType)
+			}
+			if got := rr.Header().Get("X-Total-Count"); got != "6" {
+				t.Errorf("got X-Total-Count %q; want 6", got)
+			}
+			if tt.body != "" && rr.Body.String() != tt.body {
+				t.Errorf("got body %q; want %q", rr.Body, tt.body)
+			}
+		})
+	}
+}
+
+func TestWriteCollectionMsgpack(t *testing.T) {
+	app := newTestApplication(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/items", nil)
+	r.Header.Set("Accept", "application/vnd.msgpack")
+	rr := httptest.NewRecorder()
+
+	err := app.writeCollection(rr, r, "items", testItems, data.Metadata{TotalRecords: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var env struct {
+		Items    []map[string]any `msgpack:"items"`
+		Metadata map[string]any   `msgpack:"metadata"`
+	}
+	err = msgpack.Unmarshal(rr.Body.Bytes(), &env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(env.Items) != 2 || env.Items[1]["name"] != "=second" {
+		t.Errorf("got items %v", env.Items)
+	}
+	// IDs are encoded as integers, not floats.
+	if id, ok := env.Items[0]["id"].(int64); !ok || id != 1 {
+		t.Errorf("got id %T %v; want int64 1", env.Items[0]["id"], env.Items[0]["id"])
+	}
+	if _, ok := env.Items[0]["Secret"]; ok {
+		t.Error("field tagged json:\"-\" was encoded")
+	}
+}
+
+func TestSetPaginationHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata data.Metadata
+		want     []string
+	}{
+		{
+			name:     "middle page",
+			metadata: data.Metadata{CurrentPage: 2, PageSize: 2, FirstPage: 1, LastPage: 3, TotalRecords: 6},
+			want: []string{
+				`</v1/items?page=1&page_size=2>; rel="first"`,
+				`</v1/items?page=1&page_size=2>; rel="prev"`,
+				`</v1/items?page=3&page_size=2>; rel="next"`,
+				`</v1/items?page=3&page_size=2>; rel="last"`,
+			},
+		},
+		{
+			name:     "only page",
+			metadata: data.Metadata{CurrentPage: 1, PageSize: 2, FirstPage: 1, LastPage: 1, TotalRecords: 1},
+			want: []string{
+				`</v1/items?page=1&page_size=2>; rel="first"`,
+				`</v1/items?page=1&page_size=2>; rel="last"`,
+			},
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/items?page=2&page_size=2", nil)
+			rr := httptest.NewRecorder()
+
+			setPaginationHeaders(rr, r, tt.metadata)
+
+			if got := rr.Header().Get("Link"); got != strings.Join(tt.want, ", ") {
+				t.Errorf("got Link %q; want %q", got, strings.Join(tt.want, ", "))
+			}
+		})
+	}
+}
+
+func TestEncodeCSVRoundTrip(t *testing.T) {
+	body, err := encodeCSV([]testItem{{ID: 3, Name: "a,b\nc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][1] != "a,b\nc" {
+		t.Errorf("got records %q", records)
+	}
+}
+
+func TestEncodeCSVUnsupported(t *testing.T) {
+	_, err := encodeCSV([]int{1, 2})
+	if err == nil {
+		t.Error("got no error for a slice of ints")
+	}
+}
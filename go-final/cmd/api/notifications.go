@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	data "github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/mailer"
+	"github.com/sbeknur/go-final/internal/validator"
+)
+
+func (app *application) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Unread bool
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Unread = app.readBool(qs, "unread", false, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafeList = []string{"id", "created_at", "-id", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	notifications, metadata, err := app.models.Notifications.GetAllForUser(r.Context(), user.ID, input.Unread, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeCollection(w, r, "notifications", notifications, metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.readMarkReadInput(w, r) {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	notification, err := app.models.Notifications.MarkRead(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"notification": notification}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.readMarkReadInput(w, r) {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	count, err := app.models.Notifications.MarkAllRead(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"marked_read": count}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMarkReadInput reads the {"read": true} body shared by the mark-read
+// endpoints. Marking notifications as unread again isn't supported.
+func (app *application) readMarkReadInput(w http.ResponseWriter, r *http.Request) bool {
+	var input struct {
+		Read *bool `json:"read"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+
+	v := validator.New()
+	v.Check(input.Read != nil, "read", "must be provided")
+	v.Check(input.Read == nil || *input.Read, "read", "must be true")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	return true
+}
+
+// notifyCourseUpdated tells everyone enrolled in the course that it changed,
+// both in their inbox and by email for those who haven't opted out. The
+// emails are queued one job per recipient, so that one that fails is
+// retried on its own.
+func (app *application) notifyCourseUpdated(ctx context.Context, course *data.Course) {
+	app.background(ctx, func(ctx context.Context) {
+		users, err := app.models.Enrollments.GetUsersForCourse(ctx, course.ID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		for _, user := range users {
+			notification := &data.Notification{
+				UserID:   user.ID,
+				Category: data.CategoryCourseUpdates,
+				Title:    fmt.Sprintf("Course %q was updated", course.Title),
+				Body:     fmt.Sprintf("The course %q you are enrolled in has new changes.", course.Title),
+			}
+
+			err = app.models.Notifications.Insert(ctx, notification)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+			app.publishEvent(ctx, user.ID, "notification", notification)
+
+			err = app.jobs.Enqueue(ctx, jobSendCourseUpdateEmail, sendCourseUpdateEmailArgs{
+				UserID:      user.ID,
+				CourseID:    course.ID,
+				CourseTitle: course.Title,
+			})
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	})
+}
+
+func (app *application) showNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	preferences, err := app.models.NotificationPreferences.GetForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"preferences": preferences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	// The body maps category names to whether emails in that category should
+	// be sent, e.g. {"course_updates": false}. Categories that are left out
+	// keep their current setting.
+	var input map[string]bool
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	for category := range input {
+		data.ValidateNotificationCategory(v, category)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	for category, enabled := range input {
+		err = app.models.NotificationPreferences.Set(r.Context(), user.ID, category, enabled)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	preferences, err := app.models.NotificationPreferences.GetForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"preferences": preferences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showUnsubscribeHandler only describes what the link would do. Mail scanners
+// and link previewers follow GET links, so per RFC 8058 the actual
+// unsubscribe happens on POST.
+func (app *application) showUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, category, ok := app.readUnsubscribeToken(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, r, http.StatusOK, envelope{"user_id": userID, "category": category}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, category, ok := app.readUnsubscribeToken(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.NotificationPreferences.Set(r.Context(), userID, category, false)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "you have been unsubscribed from " + category + " emails"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) readUnsubscribeToken(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	v := validator.New()
+
+	userID, category, err := app.unsubscriber.Verify(r.URL.Query().Get("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, mailer.ErrInvalidUnsubscribeToken):
+			v.AddError("token", "invalid unsubscribe token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return 0, "", false
+	}
+
+	if data.ValidateNotificationCategory(v, category); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return 0, "", false
+	}
+
+	return userID, category, true
+}
@@ -12,24 +12,56 @@ func (app *application) routes() http.Handler {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/readyz", app.readinessHandler)
+
 	router.HandlerFunc(http.MethodGet, "/v1/courses", app.listCoursesHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/courses", app.requireActivatedUser(app.createCourseHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/courses", app.requireAdminUser(app.createCourseHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/courses/:id", app.showCourseHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/courses/:id", app.requireActivatedUser(app.updateCourseHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/courses/:id", app.requireActivatedUser(app.deleteCourseHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/courses/:id", app.requireAdminUser(app.updateCourseHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/courses/:id", app.requireAdminUser(app.deleteCourseHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/courses/:id/enrollment", app.requireActivatedUser(app.createEnrollmentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/courses/:id/enrollment", app.requireActivatedUser(app.deleteEnrollmentHandler))
 
-	router.HandlerFunc(http.MethodPost, "/v1/instructors", app.requireActivatedUser(app.createInstructorHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/instructors", app.requireAdminUser(app.createInstructorHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/instructors", app.listInstructorsHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/instructors/:id", app.showInstructorHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/instructors/:id", app.requireActivatedUser(app.updateInstructorHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/instructors/:id", app.requireActivatedUser(app.deleteInstructorHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/instructors/:id", app.requireAdminUser(app.updateInstructorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/instructors/:id", app.requireAdminUser(app.deleteInstructorHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/notifications", app.requireActivatedUser(app.showNotificationPreferencesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/notifications", app.requireActivatedUser(app.updateNotificationPreferencesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/inbox", app.requireActivatedUser(app.listNotificationsHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/inbox", app.requireActivatedUser(app.markAllNotificationsReadHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/inbox/:id", app.requireActivatedUser(app.markNotificationReadHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/events/stream", app.requireActivatedUser(app.eventStreamHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/notifications/unsubscribe", app.showUnsubscribeHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/notifications/unsubscribe", app.unsubscribeHandler)
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
 	router.HandlerFunc(http.MethodPost, "/v1/files/send", app.fileHandler)
 
-	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/emails/templates", app.requireAdminUser(app.listEmailTemplatesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/emails/preview", app.requireAdminUser(app.previewEmailHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/admin/invitations", app.requireAdminUser(app.createInvitationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/invitations/:id", app.requireAdminUser(app.showInvitationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/invitations/:id", app.requireAdminUser(app.deleteInvitationHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/logging", app.requireAdminUser(app.showLoggingHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/logging", app.requireAdminUser(app.updateLoggingHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/webhooks", app.requireAdminUser(app.listWebhooksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/webhooks", app.requireAdminUser(app.createWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/webhooks/:id", app.requireAdminUser(app.showWebhookHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/webhooks/:id", app.requireAdminUser(app.updateWebhookHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/webhooks/:id", app.requireAdminUser(app.deleteWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/webhooks/:id/deliveries", app.requireAdminUser(app.listWebhookDeliveriesHandler))
+
+	return app.recordMetrics(router, app.traceRequest(router, app.logRequest(app.compress(app.secureHeaders(app.recoverPanic(app.enableCORS(app.authenticate(app.rateLimit(router)))))))))
 }
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 )
@@ -18,8 +20,29 @@ func (app *application) serve() error {
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		ErrorLog:     log.New(app.logger, "", 0),
 	}
 
+	// Shutdown doesn't wait for or interrupt long-lived event streams, so close
+	// the broker to make their handlers return.
+	srv.RegisterOnShutdown(app.broker.Close)
+
+	var redirectSrv *http.Server
+	if app.config.tls.certFile != "" {
+		var err error
+		srv.TLSConfig, err = app.tlsConfig()
+		if err != nil {
+			return err
+		}
+		redirectSrv = app.serveRedirect()
+	}
+
+	adminSrv := app.serveAdmin()
+
+	app.webhooks.Start()
+	app.jobs.Start()
+	app.scheduler.Start()
+
 	shutdownError := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -28,15 +51,67 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("shutting down server", map[string]string{
 			"signal": s.String(),
 		})
+
+		// Fail readiness checks first and keep serving for a while, so that
+		// load balancers notice and stop sending new requests before the
+		// listener closes.
+		app.shuttingDown.Store(true)
+		time.Sleep(app.config.shutdownDelay)
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 		defer cancel()
-		shutdownError <- srv.Shutdown(ctx)
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		if redirectSrv != nil {
+			err = redirectSrv.Shutdown(ctx)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"component": "redirect"})
+			}
+		}
+
+		app.webhooks.Stop()
+		app.scheduler.Stop()
+
+		app.logger.PrintInfo("completing background tasks", map[string]string{
+			"addr": srv.Addr,
+		})
+
+		// Give running jobs whatever is left of the shutdown budget. Jobs that
+		// don't finish in time are picked up again after a restart.
+		err = app.jobs.Stop(ctx)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"component": "jobs"})
+		}
+
+		app.wg.Wait()
+
+		// Shut the admin server down last so that metrics can still be
+		// scraped while the API drains.
+		if adminSrv != nil {
+			err = adminSrv.Shutdown(ctx)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"component": "admin"})
+			}
+		}
+
+		shutdownError <- nil
 	}()
 	app.logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
 		"env":  app.config.env,
+		"tls":  strconv.FormatBool(srv.TLSConfig != nil),
 	})
-	err := srv.ListenAndServe()
+
+	var err error
+	if srv.TLSConfig != nil {
+		// The certificate comes from TLSConfig.GetCertificate.
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
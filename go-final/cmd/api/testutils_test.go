@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/dbtest"
+	"github.com/sbeknur/go-final/internal/jobs"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+	"github.com/sbeknur/go-final/internal/mailer"
+	"github.com/sbeknur/go-final/internal/metrics"
+)
+
+// newTestApplication returns an application with just enough set up for
+// handlers and middleware that don't need the database. Logs are discarded.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	return &application{
+		logger:  jsonlog.New(io.Discard, jsonlog.LevelOff),
+		metrics: metrics.New(),
+	}
+}
+
+// useTestDB points the models and the job queue of app at a stub database
+// and returns it, so that the test can answer the queries it expects. The
+// queue is never started; tests run the jobs they find in the jobs table.
+func useTestDB(t *testing.T, app *application) *dbtest.DB {
+	t.Helper()
+
+	db, stub := dbtest.New(t)
+	app.models = data.NewModels(db)
+	app.jobs = jobs.New(db, app.logger, jobs.Config{Concurrency: 1, PollInterval: time.Second, LockTimeout: time.Minute, MaxAttempts: 3})
+	app.registerJobs()
+
+	return stub
+}
+
+// useMemoryMailer makes app send its email to memory and returns the
+// transport, so that tests can read what was sent.
+func useMemoryMailer(app *application) *mailer.MemoryTransport {
+	transport := mailer.NewMemoryTransport()
+	app.mailer = mailer.New(transport, "Go Final <no-reply@example.com>")
+	return transport
+}
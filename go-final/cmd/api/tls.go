@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/jsonlog"
+)
+
+// certCheckInterval is how often the certificate files are checked for
+// changes. Checks happen during handshakes, so an idle server doesn't poll.
+const certCheckInterval = 10 * time.Second
+
+// certReloader serves the certificate in certFile and keyFile, loading it
+// again when either file changes, so that renewed certificates are picked up
+// without a restart. If the new files can't be loaded the old certificate is
+// kept.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *jsonlog.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logger *jsonlog.Logger) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+
+	err := cr.load()
+	if err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *certReloader) load() error {
+	modTime, err := cr.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cr.cert = &cert
+	cr.modTime = modTime
+	return nil
+}
+
+func (cr *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+
+	for _, name := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if time.Since(cr.checkedAt) < certCheckInterval {
+		return cr.cert, nil
+	}
+	cr.checkedAt = time.Now()
+
+	modTime, err := cr.latestModTime()
+	if err != nil || modTime.Equal(cr.modTime) {
+		return cr.cert, nil
+	}
+
+	err = cr.load()
+	if err != nil {
+		// The key and certificate are usually replaced one after the other,
+		// so this may only be temporary.
+		cr.logger.Error("reloading TLS certificate failed", jsonlog.Err(err))
+		return cr.cert, nil
+	}
+
+	cr.logger.Info("reloaded TLS certificate", jsonlog.String("cert_file", cr.certFile))
+	return cr.cert, nil
+}
+
+func (app *application) tlsConfig() (*tls.Config, error) {
+	reloader, err := newCertReloader(app.config.tls.certFile, app.config.tls.keyFile, app.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}, nil
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same path on the TLS
+// listener. Only GET and HEAD are redirected; anything else could already
+// have sent credentials in the clear and is refused rather than silently
+// repeated.
+func (app *application) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Use HTTPS", http.StatusBadRequest)
+		return
+	}
+
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if app.config.port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(app.config.port))
+	}
+
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+}
+
+// serveRedirect starts the HTTP to HTTPS redirect listener in the background.
+// It returns nil if it is disabled.
+func (app *application) serveRedirect() *http.Server {
+	if app.config.tls.redirectAddr == "" {
+		return nil
+	}
+
+	srv := &http.Server{
+		Addr:         app.config.tls.redirectAddr,
+		Handler:      http.HandlerFunc(app.redirectToHTTPS),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		ErrorLog:     log.New(app.logger, "", 0),
+	}
+
+	go func() {
+		app.logger.Info("starting HTTPS redirect server", jsonlog.String("addr", srv.Addr))
+
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			app.logger.Error(err.Error(), jsonlog.String("component", "redirect"))
+		}
+	}()
+
+	return srv
+}
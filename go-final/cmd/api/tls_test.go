@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for name and its key to
+// certFile and keyFile, dated modTime.
+func writeTestCert(t *testing.T, certFile, keyFile, name string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		certFile: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyFile:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(name, contents, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func certName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+
+	writeTestCert(t, certFile, keyFile, "old.example.com", start)
+
+	cr, err := newCertReloader(certFile, keyFile, newTestApplication(t).logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() string {
+		t.Helper()
+
+		cert, err := cr.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return certName(t, cert)
+	}
+
+	if name := get(); name != "old.example.com" {
+		t.Fatalf("got certificate for %s; want old.example.com", name)
+	}
+
+	// The files are only checked every certCheckInterval.
+	writeTestCert(t, certFile, keyFile, "new.example.com", start.Add(time.Minute))
+	if name := get(); name != "old.example.com" {
+		t.Errorf("got certificate for %s before the check interval passed", name)
+	}
+
+	cr.checkedAt = time.Time{}
+	if name := get(); name != "new.example.com" {
+		t.Errorf("got certificate for %s; want the renewed new.example.com", name)
+	}
+
+	// A half-written renewal keeps the certificate being served.
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(keyFile, start.Add(2*time.Minute), start.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	cr.checkedAt = time.Time{}
+	if name := get(); name != "new.example.com" {
+		t.Errorf("got certificate for %s after a broken renewal; want new.example.com", name)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		host     string
+		port     int
+		status   int
+		location string
+	}{
+		{"default port", http.MethodGet, "example.com", 443, http.StatusPermanentRedirect, "https://example.com/v1/courses?page=2"},
+		{"port in host", http.MethodHead, "example.com:80", 443, http.StatusPermanentRedirect, "https://example.com/v1/courses?page=2"},
+		{"other port", http.MethodGet, "example.com:8080", 4000, http.StatusPermanentRedirect, "https://example.com:4000/v1/courses?page=2"},
+		{"post", http.MethodPost, "example.com", 443, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.port = tt.port
+
+			r := httptest.NewRequest(tt.method, "/v1/courses?page=2", nil)
+			r.Host = tt.host
+			rr := httptest.NewRecorder()
+			app.redirectToHTTPS(rr, r)
+
+			if rr.Code != tt.status {
+				t.Errorf("got status %d; want %d", rr.Code, tt.status)
+			}
+			if location := rr.Header().Get("Location"); location != tt.location {
+				t.Errorf("got Location %q; want %q", location, tt.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/sbeknur/go-final/cmd/api")
+
+// traceRequest starts a span for every request, continuing the trace from a
+// W3C traceparent header if the caller sent one. The trace and span IDs are
+// added to the context's log fields, so every line logged for the request
+// can be matched to its trace.
+func (app *application) traceRequest(router *httprouter.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := matchedRoute(router, r)
+
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(app.clientIP(r)),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = jsonlog.ContextWithFields(ctx,
+				jsonlog.String("trace_id", sc.TraceID().String()),
+				jsonlog.String("span_id", sc.SpanID().String()),
+			)
+		}
+
+		metrics := httpsnoop.CaptureMetrics(next, w, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(metrics.Code))
+		if metrics.Code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(metrics.Code))
+		}
+	})
+}
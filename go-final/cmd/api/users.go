@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 
 	"net/http"
-	"time"
 
 	"github.com/sbeknur/go-final/internal/data"
 	"github.com/sbeknur/go-final/internal/validator"
@@ -13,10 +14,11 @@ import (
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	// Create an anonymous struct to hold the expected data from the request body.
 	var input struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		Role     string `json:"role"`
+		Name        string `json:"name"`
+		Email       string `json:"email"`
+		Password    string `json:"password"`
+		Locale      string `json:"locale"`
+		InviteToken string `json:"invite_token"`
 	}
 	// Parse the request body into the anonymous struct.
 	err := app.readJSON(w, r, &input)
@@ -28,11 +30,20 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	// set the Activated field to false, which isn't strictly necessary because the
 	// Activated field will have the zero-value of false by default. But setting this
 	// explicitly helps to make our intentions clear to anyone reading the code.
+	//
+	// The role is never taken from the request. Anyone can register, so only an
+	// invitation created by an admin may grant a different one.
 	user := &data.User{
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false,
-		Role:      input.Role,
+		Role:      data.DefaultRole,
+		Locale:    input.Locale,
+	}
+	// Users who don't pick a locale get the default one, which is also what the
+	// welcome email falls back to.
+	if user.Locale == "" {
+		user.Locale = data.SupportedLocales[0]
 	}
 	// Use the Password.Set() method to generate and store the hashed and plaintext
 	// passwords.
@@ -43,6 +54,21 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 	v := validator.New()
 
+	var invitation *data.Invitation
+	if input.InviteToken != "" {
+		invitation, err = app.invitationForToken(r, v, input.InviteToken, user.Email)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		// The token was emailed to the invited address, so there is no need
+		// to confirm it again.
+		if invitation != nil {
+			user.Role = invitation.Role
+			user.Activated = true
+		}
+	}
+
 	// Validate the user struct and return the error messages to the client if any of
 	// the checks fail.
 	if data.ValidateUser(v, user); !v.Valid() {
@@ -50,8 +76,19 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Insert the user data into the database.
-	err = app.models.Users.Insert(user)
+	// Insert the user data into the database. Invited users are activated
+	// straight away, so there is no activation token to email. Everyone else
+	// gets the welcome email, which also creates the activation token. It is
+	// queued in the same transaction, so that the user is only created if the
+	// email will be sent. The job survives restarts and is retried if the mail
+	// server is unavailable.
+	if invitation != nil {
+		err = app.models.Users.InsertInvited(r.Context(), user, invitation.ID)
+	} else {
+		err = app.models.Users.Insert(r.Context(), user, func(ctx context.Context, tx *sql.Tx) error {
+			return app.jobs.EnqueueTx(ctx, tx, jobSendWelcomeEmail, sendWelcomeEmailArgs{UserID: user.ID})
+		})
+	}
 	if err != nil {
 		switch {
 		// If we get a ErrDuplicateEmail error, use the v.AddError() method to manually
@@ -60,55 +97,23 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "a user with this email address already exists")
 			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrInvalidInvitation):
+			v.AddError("invite_token", "invalid or expired invitation token")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	// After the user record has been created in the database, generate a new activation
-	// token for the user.
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+	// Write a JSON response containing the user data. Invited users are already
+	// active, so they get 201 Created rather than 202 Accepted.
+	status := http.StatusAccepted
+	if user.Activated {
+		status = http.StatusCreated
 	}
 
-	// Call the Send() method on our Mailer, passing in the user's email address,
-	// name of the template file, and the User struct containing the new user's data.
-	//err = app.mailer.Send(user.Email, "user_welcome.tmpl", user)
-	//if err != nil {
-	//	app.serverErrorResponse(w, r, err)
-	//	return
-	//}
-
-	// Launch a goroutine which runs an anonymous function that sends the welcome email.
-	app.background(func() {
-		// As there are now multiple pieces of data that we want to pass to our email
-		// templates, we create a map to act as a 'holding structure' for the data. This
-		// contains the plaintext version of the activation token for the user, along
-		// with their ID.
-		app.background(func() {
-			data := map[string]any{
-				"activationToken": token.Plaintext,
-				"userID":          user.ID,
-			}
-
-			err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
-			if err != nil {
-				app.logger.PrintError(err, nil)
-			}
-		})
-
-		err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-		}
-	})
-
-	// Write a JSON response containing the user data along with a 201 Created status
-	// code.
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	err = app.writeJSON(w, r, status, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -138,7 +143,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	// Retrieve the details of the user associated with the token using the
 	// GetForToken() method (which we will create in a minute). If no matching record
 	// is found, then we let the client know that the token they provided is not valid.
-	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
+	user, err := app.models.Users.GetForToken(r.Context(), data.ScopeActivation, input.TokenPlaintext)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -158,8 +163,9 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	// Save the updated user record in our database, checking for any edit conflicts in
-	// the same way that we did for our movie records.
-	err = app.models.Users.Update(user)
+	// the same way that we did for our movie records. The user's activation tokens
+	// are deleted and the webhook event queued in the same transaction.
+	err = app.models.Users.Activate(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -169,15 +175,8 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	// If everything went successfully, then we delete all activation tokens for the
-	// user.
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
 	// Send the updated user details to the client in a JSON response.
-	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/dbtest"
+)
+
+var activationTokenRX = regexp.MustCompile(`"token": "([A-Z2-7]{26})"`)
+
+func TestRegisterAndActivate(t *testing.T) {
+	app := newTestApplication(t)
+	stub := useTestDB(t, app)
+	transport := useMemoryMailer(app)
+
+	// The stub database keeps the one user, the jobs queued for it and the
+	// hashes of its tokens.
+	var (
+		user      []any
+		queued    [][]any
+		tokenHash []byte
+	)
+	columns := []string{"id", "created_at", "name", "email", "password_hash", "activated", "version", "role", "locale"}
+
+	stub.Query("INSERT INTO users", func(args []any) (*dbtest.Rows, error) {
+		user = []any{int64(1), time.Now(), args[0], args[1], args[2], args[3], int64(1), args[4], args[5]}
+		return &dbtest.Rows{Columns: []string{"id", "created_at", "version"}, Values: [][]any{{int64(1), time.Now(), int64(1)}}}, nil
+	})
+	stub.Query("FROM users WHERE id = $1", func(args []any) (*dbtest.Rows, error) {
+		return &dbtest.Rows{Columns: columns, Values: [][]any{user}}, nil
+	})
+	stub.Exec("INSERT INTO jobs", func(args []any) (int64, error) {
+		queued = append(queued, args)
+		return 1, nil
+	})
+	stub.Exec("INSERT INTO tokens", func(args []any) (int64, error) {
+		if args[3] != data.ScopeActivation {
+			t.Errorf("got token scope %v; want %q", args[3], data.ScopeActivation)
+		}
+		tokenHash = args[0].([]byte)
+		return 1, nil
+	})
+	stub.Query("INNER JOIN tokens", func(args []any) (*dbtest.Rows, error) {
+		rows := &dbtest.Rows{Columns: columns}
+		if bytes.Equal(args[0].([]byte), tokenHash) && args[1] == data.ScopeActivation {
+			rows.Values = append(rows.Values, user)
+		}
+		return rows, nil
+	})
+	stub.Query("UPDATE users", func(args []any) (*dbtest.Rows, error) {
+		user[5] = args[3]
+		return &dbtest.Rows{Columns: []string{"version"}, Values: [][]any{{int64(2)}}}, nil
+	})
+	stub.Exec("DELETE FROM tokens", func(args []any) (int64, error) {
+		tokenHash = nil
+		return 1, nil
+	})
+	stub.Exec("INSERT INTO webhook_deliveries", func(args []any) (int64, error) { return 0, nil })
+
+	body := `{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234"}`
+	rr := httptest.NewRecorder()
+	app.registerUserHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body)))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("register: got status %d; want %d: %s", rr.Code, http.StatusAccepted, rr.Body)
+	}
+
+	// Registration only queues the welcome email, in the same transaction as
+	// the user; nothing is sent until the job runs.
+	if commits, _ := stub.Transactions(); commits != 1 {
+		t.Errorf("got %d commits; want 1", commits)
+	}
+	if len(queued) != 1 || queued[0][0] != jobSendWelcomeEmail {
+		t.Fatalf("got queued jobs %v; want one %s", queued, jobSendWelcomeEmail)
+	}
+	if len(transport.Messages()) != 0 {
+		t.Fatal("email sent before the job ran")
+	}
+
+	var args sendWelcomeEmailArgs
+	if err := json.Unmarshal(queued[0][1].([]byte), &args); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.sendWelcomeEmailJob(context.Background(), args); err != nil {
+		t.Fatalf("welcome email job: %v", err)
+	}
+
+	msg, ok := transport.Last("alice@example.com")
+	if !ok {
+		t.Fatal("no welcome email sent")
+	}
+	match := activationTokenRX.FindStringSubmatch(msg.PlainBody)
+	if match == nil {
+		t.Fatalf("no activation token in the welcome email:\n%s", msg.PlainBody)
+	}
+	if hash := sha256.Sum256([]byte(match[1])); !bytes.Equal(hash[:], tokenHash) {
+		t.Fatal("the emailed token doesn't match the stored hash")
+	}
+
+	body = `{"token": "` + match[1] + `", "newpassword": "pa55word5678"}`
+	rr = httptest.NewRecorder()
+	app.activateUserHandler(rr, httptest.NewRequest(http.MethodPut, "/v1/users/activated", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("activate: got status %d; want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	if user[5] != true {
+		t.Error("user not activated")
+	}
+
+	// The token is deleted on activation and can't be used again.
+	rr = httptest.NewRecorder()
+	app.activateUserHandler(rr, httptest.NewRequest(http.MethodPut, "/v1/users/activated", strings.NewReader(body)))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("second activation: got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+}
@@ -25,27 +25,55 @@ type CourseModel struct {
 	DB *sql.DB
 }
 
-func (m CourseModel) Insert(course *Course) error {
-	query :=
-		`INSERT INTO courses (title, published_date, runtime, lectures)
-		 VALUES ($1, $2, $3, $4)
-		 RETURNING id, created_at, version`
-	args := []any{course.Title, course.Published_date, course.Runtime, pq.Array(course.Lectures)}
+func (m CourseModel) Insert(ctx context.Context, course *Course) error {
+	ctx, span := startSpan(ctx, "CourseModel.Insert", insertCourseQuery)
+	defer span.End()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&course.ID, &course.CreatedAt, &course.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertCourse(ctx, tx, course)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m CourseModel) Get(id int64) (*Course, error) {
+const insertCourseQuery = `
+INSERT INTO courses (title, published_date, runtime, lectures)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, version`
+
+// insertCourse inserts the course and queues EventCourseCreated in tx.
+func insertCourse(ctx context.Context, tx *sql.Tx, course *Course) error {
+	args := []any{course.Title, course.Published_date, course.Runtime, pq.Array(course.Lectures)}
+
+	err := tx.QueryRowContext(ctx, insertCourseQuery, args...).Scan(&course.ID, &course.CreatedAt, &course.Version)
+	if err != nil {
+		return err
+	}
+
+	return enqueueWebhookEvent(ctx, tx, EventCourseCreated, course)
+}
+
+func (m CourseModel) Get(ctx context.Context, id int64) (*Course, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	query := `SELECT * FROM courses WHERE id = $1`
 
 	var course Course
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, span := startSpan(ctx, "CourseModel.Get", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -70,7 +98,7 @@ func (m CourseModel) Get(id int64) (*Course, error) {
 	return &course, nil
 }
 
-func (m CourseModel) GetAll(title string, lectures []string, filters Filters) ([]*Course, Metadata, error) {
+func (m CourseModel) GetAll(ctx context.Context, title string, lectures []string, filters Filters) ([]*Course, Metadata, error) {
 	query := fmt.Sprintf(` 
 		SELECT COUNT(*) OVER(), id, created_at, title, published_date, runtime, lectures, version
 		FROM courses 
@@ -79,7 +107,10 @@ func (m CourseModel) GetAll(title string, lectures []string, filters Filters) ([
 		ORDER BY %s %s, id ASC
 		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, span := startSpan(ctx, "CourseModel.GetAll", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	args := []any{title, pq.Array(lectures), filters.limit(), filters.offset()}
@@ -120,7 +151,7 @@ func (m CourseModel) GetAll(title string, lectures []string, filters Filters) ([
 	return courses, metadata, nil
 }
 
-func (m CourseModel) Update(course *Course) error {
+func (m CourseModel) Update(ctx context.Context, course *Course) error {
 	query :=
 		`UPDATE courses
 		 SET title = $1, published_date = $2, runtime = $3, lectures = $4, version = version + 1
@@ -136,10 +167,19 @@ func (m CourseModel) Update(course *Course) error {
 		course.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, span := startSpan(ctx, "CourseModel.Update", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&course.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&course.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -149,24 +189,38 @@ func (m CourseModel) Update(course *Course) error {
 		}
 	}
 
-	return nil
+	err = enqueueWebhookEvent(ctx, tx, EventCourseUpdated, course)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m CourseModel) Delete(id int64) error {
+func (m CourseModel) Delete(ctx context.Context, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 	query := `DELETE FROM courses WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, span := startSpan(ctx, "CourseModel.Delete", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	rowsAffected, err := recordRowsAffected(span, result)
 	if err != nil {
 		return err
 	}
@@ -175,7 +229,12 @@ func (m CourseModel) Delete(id int64) error {
 		return ErrRecordNotFound
 	}
 
-	return nil
+	err = enqueueWebhookEvent(ctx, tx, EventCourseDeleted, map[string]int64{"id": id})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func ValidateCourse(v *validator.Validator, course *Course) {
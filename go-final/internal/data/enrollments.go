@@ -0,0 +1,103 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type EnrollmentModel struct {
+	DB *sql.DB
+}
+
+// Insert enrolls the user in the course. Enrolling twice is not an error.
+func (m EnrollmentModel) Insert(ctx context.Context, userID, courseID int64) error {
+	query := `
+		INSERT INTO enrollments (user_id, course_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, span := startSpan(ctx, "EnrollmentModel.Insert", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, courseID)
+	return err
+}
+
+func (m EnrollmentModel) Delete(ctx context.Context, userID, courseID int64) error {
+	query := `
+		DELETE FROM enrollments
+		WHERE user_id = $1 AND course_id = $2`
+
+	ctx, span := startSpan(ctx, "EnrollmentModel.Delete", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, courseID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := recordRowsAffected(span, result)
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetUsersForCourse returns the activated users enrolled in the course.
+func (m EnrollmentModel) GetUsersForCourse(ctx context.Context, courseID int64) ([]*User, error) {
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.activated, users.role, users.locale
+		FROM users
+		INNER JOIN enrollments ON users.id = enrollments.user_id
+		WHERE enrollments.course_id = $1 AND users.activated
+		ORDER BY users.id`
+
+	ctx, span := startSpan(ctx, "EnrollmentModel.GetUsersForCourse", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Role,
+			&user.Locale,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
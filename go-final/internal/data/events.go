@@ -0,0 +1,157 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// EventsChannel is the Postgres NOTIFY channel new event IDs are sent on.
+const EventsChannel = "events"
+
+// Event is something clients may want to hear about in real time. Events
+// with a zero UserID are broadcast to every connected user.
+type Event struct {
+	ID        int64           `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	UserID    int64           `json:"-"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type EventModel struct {
+	DB *sql.DB
+}
+
+// Insert stores the event and notifies every listening API instance of its
+// ID. Postgres only delivers the notification once the insert is visible.
+func (m EventModel) Insert(ctx context.Context, event *Event) error {
+	query := `
+		INSERT INTO events (user_id, type, data)
+		VALUES (NULLIF($1, 0), $2, $3)
+		RETURNING id, created_at`
+
+	args := []any{event.UserID, event.Type, []byte(event.Data)}
+
+	ctx, span := startSpan(ctx, "EventModel.Insert", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `SELECT pg_notify($1, $2)`, EventsChannel, strconv.FormatInt(event.ID, 10))
+	return err
+}
+
+func (m EventModel) Get(ctx context.Context, id int64) (*Event, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, COALESCE(user_id, 0), type, data
+		FROM events
+		WHERE id = $1`
+
+	ctx, span := startSpan(ctx, "EventModel.Get", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var event Event
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&event.ID,
+		&event.CreatedAt,
+		&event.UserID,
+		&event.Type,
+		&event.Data,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &event, nil
+}
+
+// GetSince returns up to limit events visible to the user with an ID greater
+// than afterID, oldest first. It is used to replay what a client missed.
+func (m EventModel) GetSince(ctx context.Context, userID, afterID int64, limit int) ([]*Event, error) {
+	query := `
+		SELECT id, created_at, COALESCE(user_id, 0), type, data
+		FROM events
+		WHERE id > $1 AND (user_id IS NULL OR user_id = $2)
+		ORDER BY id ASC
+		LIMIT $3`
+
+	ctx, span := startSpan(ctx, "EventModel.GetSince", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, afterID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		var event Event
+		err := rows.Scan(
+			&event.ID,
+			&event.CreatedAt,
+			&event.UserID,
+			&event.Type,
+			&event.Data,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// DeleteOlderThan removes events created before before and returns how many
+// were deleted. Clients that reconnect with the ID of a deleted event are
+// only sent the newer events that are left.
+func (m EventModel) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM events
+		WHERE created_at < $1`
+
+	ctx, span := startSpan(ctx, "EventModel.DeleteOlderThan", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return recordRowsAffected(span, result)
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/sbeknur/go-final/internal/validator"
 )
 
 type Instructors struct {
@@ -19,14 +21,17 @@ type InstructorsModel struct {
 	DB *sql.DB
 }
 
-func (a InstructorsModel) Get(id int64) (*Instructors, error) {
+func (a InstructorsModel) Get(ctx context.Context, id int64) (*Instructors, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	query := `SELECT * FROM instructors WHERE id = $1`
 
 	var instructor Instructors
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, span := startSpan(ctx, "InstructorsModel.Get", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := a.DB.QueryRowContext(ctx, query, id).Scan(
@@ -48,17 +53,25 @@ func (a InstructorsModel) Get(id int64) (*Instructors, error) {
 	return &instructor, nil
 }
 
-func (a InstructorsModel) Insert(instructors *Instructors) error {
-	query :=
-		`INSERT INTO instructors (firstName, lastName, age)
-		 VALUES ($1, $2, $3)
-		 RETURNING id`
+func (a InstructorsModel) Insert(ctx context.Context, instructors *Instructors) error {
+	ctx, span := startSpan(ctx, "InstructorsModel.Insert", insertInstructorQuery)
+	defer span.End()
+
+	return insertInstructor(ctx, a.DB, instructors)
+}
+
+const insertInstructorQuery = `
+INSERT INTO instructors (firstName, lastName, age)
+VALUES ($1, $2, $3)
+RETURNING id`
+
+func insertInstructor(ctx context.Context, db rowQueryer, instructors *Instructors) error {
 	args := []any{instructors.FirstName, instructors.LastName, instructors.Age}
 
-	return a.DB.QueryRow(query, args...).Scan(&instructors.ID)
+	return db.QueryRowContext(ctx, insertInstructorQuery, args...).Scan(&instructors.ID)
 }
 
-func (a InstructorsModel) GetAll(firstName string, lastName string, filters Filters) ([]*Instructors, Metadata, error) {
+func (a InstructorsModel) GetAll(ctx context.Context, firstName string, lastName string, filters Filters) ([]*Instructors, Metadata, error) {
 	query := fmt.Sprintf(` 
 		SELECT COUNT(*) OVER(), id, firstName, lastName, age
 		FROM instructors
@@ -67,7 +80,10 @@ func (a InstructorsModel) GetAll(firstName string, lastName string, filters Filt
 		ORDER BY %s %s, id ASC
 		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, span := startSpan(ctx, "InstructorsModel.GetAll", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	args := []any{firstName, lastName, filters.limit(), filters.offset()}
@@ -105,7 +121,7 @@ func (a InstructorsModel) GetAll(firstName string, lastName string, filters Filt
 	return instructors, metadata, nil
 }
 
-func (a InstructorsModel) Update(instructor *Instructors) error {
+func (a InstructorsModel) Update(ctx context.Context, instructor *Instructors) error {
 	query :=
 		`UPDATE instructors
 		 SET first_name = $1, last_name = $2, age = $3
@@ -118,7 +134,10 @@ func (a InstructorsModel) Update(instructor *Instructors) error {
 		&instructor.Age,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, span := startSpan(ctx, "InstructorsModel.Update", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := a.DB.QueryRowContext(ctx, query, args...).Scan(&instructor.ID)
@@ -134,13 +153,16 @@ func (a InstructorsModel) Update(instructor *Instructors) error {
 	return nil
 }
 
-func (a InstructorsModel) Delete(id int64) error {
+func (a InstructorsModel) Delete(ctx context.Context, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 	query := `DELETE FROM instructors WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, span := startSpan(ctx, "InstructorsModel.Delete", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	result, err := a.DB.ExecContext(ctx, query, id)
@@ -148,7 +170,7 @@ func (a InstructorsModel) Delete(id int64) error {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	rowsAffected, err := recordRowsAffected(span, result)
 	if err != nil {
 		return err
 	}
@@ -159,3 +181,11 @@ func (a InstructorsModel) Delete(id int64) error {
 
 	return nil
 }
+
+func ValidateInstructor(v *validator.Validator, instructor *Instructors) {
+	v.Check(instructor.FirstName != "", "first_name", "must be provided")
+	v.Check(len(instructor.FirstName) <= 500, "first_name", "must not be more than 500 bytes long")
+	v.Check(instructor.LastName != "", "last_name", "must be provided")
+	v.Check(len(instructor.LastName) <= 500, "last_name", "must not be more than 500 bytes long")
+	v.Check(instructor.Age > 0, "age", "must be a positive integer")
+}
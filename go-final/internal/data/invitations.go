@@ -0,0 +1,174 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/validator"
+)
+
+// ErrInvalidInvitation is returned when an invitation has expired or has
+// already been used.
+var ErrInvalidInvitation = errors.New("invalid invitation")
+
+// Invitation lets someone register with a role other than the default one.
+// Only the hash of its token is stored; the plaintext is emailed to the
+// invited address.
+type Invitation struct {
+	// Plaintext is the token, set by Insert only.
+	Plaintext  string     `json:"-"`
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	InvitedBy  *int64     `json:"invited_by"`
+	Expiry     time.Time  `json:"expiry"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+}
+
+type InvitationModel struct {
+	DB *sql.DB
+}
+
+func ValidateInvitation(v *validator.Validator, invitation *Invitation) {
+	ValidateEmail(v, invitation.Email)
+	ValidateRole(v, invitation.Role)
+}
+
+// Insert inserts the invitation with a new token, whose plaintext it sets on
+// the invitation, and then runs then, if it isn't nil, in the same
+// transaction.
+func (m InvitationModel) Insert(ctx context.Context, invitation *Invitation, then TxFunc) error {
+	plaintext, hash, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO invitations (email, role, invited_by, hash, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	args := []any{invitation.Email, invitation.Role, invitation.InvitedBy, hash, invitation.Expiry}
+
+	ctx, span := startSpan(ctx, "InvitationModel.Insert", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return err
+	}
+	invitation.Plaintext = plaintext
+
+	if then != nil {
+		err = then(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m InvitationModel) Get(ctx context.Context, id int64) (*Invitation, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, email, role, invited_by, expiry, accepted_at
+		FROM invitations
+		WHERE id = $1`
+
+	ctx, span := startSpan(ctx, "InvitationModel.Get", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return scanInvitation(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetForToken returns the pending invitation with the given token.
+func (m InvitationModel) GetForToken(ctx context.Context, tokenPlaintext string) (*Invitation, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT id, created_at, email, role, invited_by, expiry, accepted_at
+		FROM invitations
+		WHERE hash = $1 AND accepted_at IS NULL AND expiry > $2`
+
+	ctx, span := startSpan(ctx, "InvitationModel.GetForToken", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return scanInvitation(m.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now()))
+}
+
+func (m InvitationModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM invitations WHERE id = $1`
+
+	ctx, span := startSpan(ctx, "InvitationModel.Delete", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := recordRowsAffected(span, result)
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func scanInvitation(row *sql.Row) (*Invitation, error) {
+	var invitation Invitation
+
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.CreatedAt,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.InvitedBy,
+		&invitation.Expiry,
+		&invitation.AcceptedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &invitation, nil
+}
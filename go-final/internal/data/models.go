@@ -1,27 +1,45 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
 
+// TxFunc runs further statements in the transaction of a model method, such
+// as queueing a job, so that they are committed or rolled back together with
+// the change itself.
+type TxFunc func(ctx context.Context, tx *sql.Tx) error
+
 var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
 type Models struct {
-	Courses     CourseModel
-	Instructors InstructorsModel
-	Tokens      TokenModel
-	Users       UserModel
+	Courses                 CourseModel
+	Enrollments             EnrollmentModel
+	Events                  EventModel
+	Instructors             InstructorsModel
+	Invitations             InvitationModel
+	Notifications           NotificationModel
+	NotificationPreferences NotificationPreferenceModel
+	Tokens                  TokenModel
+	Users                   UserModel
+	Webhooks                WebhookModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Courses:     CourseModel{DB: db},
-		Instructors: InstructorsModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		Courses:                 CourseModel{DB: db},
+		Enrollments:             EnrollmentModel{DB: db},
+		Events:                  EventModel{DB: db},
+		Instructors:             InstructorsModel{DB: db},
+		Invitations:             InvitationModel{DB: db},
+		Notifications:           NotificationModel{DB: db},
+		NotificationPreferences: NotificationPreferenceModel{DB: db},
+		Tokens:                  TokenModel{DB: db},
+		Users:                   UserModel{DB: db},
+		Webhooks:                WebhookModel{DB: db},
 	}
 }
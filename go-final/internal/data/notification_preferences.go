@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/validator"
+)
+
+// Notification categories users can opt out of. Account emails such as the
+// welcome message are transactional and always sent.
+const (
+	CategoryCourseUpdates = "course_updates"
+	CategoryEnrollments   = "enrollments"
+	CategoryDigest        = "digest"
+)
+
+var NotificationCategories = []string{CategoryCourseUpdates, CategoryEnrollments, CategoryDigest}
+
+type NotificationPreferenceModel struct {
+	DB *sql.DB
+}
+
+// GetForUser returns the email preference for every category. Categories the
+// user never touched are enabled.
+func (m NotificationPreferenceModel) GetForUser(ctx context.Context, userID int64) (map[string]bool, error) {
+	query := `
+		SELECT category, email_enabled
+		FROM notification_preferences
+		WHERE user_id = $1`
+
+	ctx, span := startSpan(ctx, "NotificationPreferenceModel.GetForUser", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	preferences := make(map[string]bool, len(NotificationCategories))
+	for _, category := range NotificationCategories {
+		preferences[category] = true
+	}
+
+	for rows.Next() {
+		var category string
+		var enabled bool
+
+		err := rows.Scan(&category, &enabled)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := preferences[category]; ok {
+			preferences[category] = enabled
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return preferences, nil
+}
+
+func (m NotificationPreferenceModel) Set(ctx context.Context, userID int64, category string, enabled bool) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, category, email_enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, category)
+		DO UPDATE SET email_enabled = EXCLUDED.email_enabled, updated_at = NOW()`
+
+	ctx, span := startSpan(ctx, "NotificationPreferenceModel.Set", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, category, enabled)
+	return err
+}
+
+// EmailEnabled reports whether the user wants emails in the category. It
+// satisfies the mailer.Preferences interface.
+func (m NotificationPreferenceModel) EmailEnabled(ctx context.Context, userID int64, category string) (bool, error) {
+	query := `
+		SELECT email_enabled
+		FROM notification_preferences
+		WHERE user_id = $1 AND category = $2`
+
+	ctx, span := startSpan(ctx, "NotificationPreferenceModel.EmailEnabled", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var enabled bool
+
+	err := m.DB.QueryRowContext(ctx, query, userID, category).Scan(&enabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return enabled, nil
+}
+
+func ValidateNotificationCategory(v *validator.Validator, category string) {
+	v.Check(validator.PermittedValue(category, NotificationCategories...), category, "unknown notification category")
+}
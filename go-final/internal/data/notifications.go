@@ -0,0 +1,194 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Notification struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	Category  string     `json:"category"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+func (m NotificationModel) Insert(ctx context.Context, notification *Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, category, title, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	args := []any{notification.UserID, notification.Category, notification.Title, notification.Body}
+
+	ctx, span := startSpan(ctx, "NotificationModel.Insert", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&notification.ID, &notification.CreatedAt)
+}
+
+func (m NotificationModel) GetAllForUser(ctx context.Context, userID int64, unreadOnly bool, filters Filters) ([]*Notification, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, user_id, created_at, category, title, body, read_at
+		FROM notifications
+		WHERE user_id = $1
+		AND (read_at IS NULL OR NOT $2)
+		ORDER BY %s %s, id DESC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, span := startSpan(ctx, "NotificationModel.GetAllForUser", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	args := []any{userID, unreadOnly, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	notifications := []*Notification{}
+	for rows.Next() {
+		var notification Notification
+		err := rows.Scan(
+			&totalRecords,
+			&notification.ID,
+			&notification.UserID,
+			&notification.CreatedAt,
+			&notification.Category,
+			&notification.Title,
+			&notification.Body,
+			&notification.ReadAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		notifications = append(notifications, &notification)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return notifications, metadata, nil
+}
+
+// MarkRead marks a single notification belonging to the user as read.
+// Notifications that were already read keep their original read_at.
+func (m NotificationModel) MarkRead(ctx context.Context, id, userID int64) (*Notification, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2
+		RETURNING id, user_id, created_at, category, title, body, read_at`
+
+	ctx, span := startSpan(ctx, "NotificationModel.MarkRead", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var notification Notification
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&notification.ID,
+		&notification.UserID,
+		&notification.CreatedAt,
+		&notification.Category,
+		&notification.Title,
+		&notification.Body,
+		&notification.ReadAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &notification, nil
+}
+
+// MarkAllRead marks every unread notification of the user as read and
+// returns how many were changed.
+func (m NotificationModel) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	query := `
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, span := startSpan(ctx, "NotificationModel.MarkAllRead", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return recordRowsAffected(span, result)
+}
+
+// GetUsersWithUnread returns the IDs of users who received notifications
+// since the given time that they haven't read yet.
+func (m NotificationModel) GetUsersWithUnread(ctx context.Context, since time.Time) ([]int64, error) {
+	query := `
+		SELECT DISTINCT user_id
+		FROM notifications
+		WHERE read_at IS NULL AND created_at >= $1
+		ORDER BY user_id`
+
+	ctx, span := startSpan(ctx, "NotificationModel.GetUsersWithUnread", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []int64{}
+	for rows.Next() {
+		var userID int64
+		err := rows.Scan(&userID)
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return userIDs, nil
+}
@@ -0,0 +1,68 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Seed inserts sample courses and instructors in one transaction, so that a
+// failure part way through leaves nothing behind.
+func Seed(ctx context.Context, db *sql.DB, courses []*Course, instructors []*Instructors) error {
+	ctx, span := startSpan(ctx, "Seed", "")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, course := range courses {
+		err = insertCourse(ctx, tx, course)
+		if err != nil {
+			return fmt.Errorf("course %q: %w", course.Title, err)
+		}
+	}
+
+	for _, instructor := range instructors {
+		err = insertInstructor(ctx, tx, instructor)
+		if err != nil {
+			return fmt.Errorf("instructor %s %s: %w", instructor.FirstName, instructor.LastName, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReindexTables are the tables Reindex accepts. The courses indexes back the
+// full text search and bloat the most as courses are edited.
+var ReindexTables = []string{
+	"courses",
+	"enrollments",
+	"events",
+	"invitations",
+	"jobs",
+	"notifications",
+	"tokens",
+	"users",
+	"webhook_deliveries",
+}
+
+// Reindex rebuilds the indexes of table without blocking writes to it. It
+// can't run inside a transaction and needs Postgres 12 or newer.
+func Reindex(ctx context.Context, db *sql.DB, table string) error {
+	query := `REINDEX TABLE CONCURRENTLY ` + pq.QuoteIdentifier(table)
+
+	ctx, span := startSpan(ctx, "Reindex", query)
+	defer span.End()
+
+	_, err := db.ExecContext(ctx, query)
+	return err
+}
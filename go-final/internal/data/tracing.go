@@ -0,0 +1,40 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/sbeknur/go-final/internal/data")
+
+// startSpan starts a span for a model method as a child of the span in ctx,
+// usually that of the request or job the query is made for. query is
+// recorded as the statement; methods that run several queries pass the main
+// one.
+func startSpan(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{semconv.DBSystemPostgreSQL}
+	if query != "" {
+		attrs = append(attrs, semconv.DBStatement(query))
+	}
+
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// recordRowsAffected returns result.RowsAffected() and records it on span.
+func recordRowsAffected(span trace.Span, result sql.Result) (int64, error) {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	span.SetAttributes(attribute.Int64("db.rows_affected", rowsAffected))
+	return rowsAffected, nil
+}
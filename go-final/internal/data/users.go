@@ -17,6 +17,13 @@ var (
 
 var AnonymousUser = &User{}
 
+// DefaultRole is the role of users who register without an invitation.
+const DefaultRole = "user"
+
+// SupportedLocales lists the locales we have email templates for. The first
+// entry is the default for users who don't pick one.
+var SupportedLocales = []string{"en", "ru", "kk"}
+
 type User struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
@@ -25,6 +32,7 @@ type User struct {
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Role      string    `json:"role"`
+	Locale    string    `json:"locale"`
 	Version   int       `json:"-"`
 }
 
@@ -41,19 +49,101 @@ func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
-func (m UserModel) Insert(user *User) error {
+// Insert inserts the user and then runs then, if it isn't nil, in the same
+// transaction.
+func (m UserModel) Insert(ctx context.Context, user *User, then TxFunc) error {
+	ctx, span := startSpan(ctx, "UserModel.Insert", insertUserQuery)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	if then != nil {
+		err = then(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// InsertInvited inserts a user who registered with an invitation and marks
+// the invitation as accepted, so that it can't be used twice. It returns
+// ErrInvalidInvitation if it was accepted or expired in the meantime.
+// Invited users are activated, so EventUserActivated is queued with them.
+func (m UserModel) InsertInvited(ctx context.Context, user *User, invitationID int64) error {
 	query := `
-INSERT INTO users (name, email, password_hash, activated, role)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, created_at, version`
-	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated, user.Role}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+UPDATE invitations
+SET accepted_at = NOW()
+WHERE id = $1 AND accepted_at IS NULL AND expiry > NOW()`
+
+	ctx, span := startSpan(ctx, "UserModel.InsertInvited", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, invitationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := recordRowsAffected(span, result)
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrInvalidInvitation
+	}
+
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	err = enqueueWebhookEvent(ctx, tx, EventUserActivated, user)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const insertUserQuery = `
+INSERT INTO users (name, email, password_hash, activated, role, locale)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at, version`
+
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func insertUser(ctx context.Context, db rowQueryer, user *User) error {
+	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated, user.Role, user.Locale}
+
 	// If the table already contains a record with this email address, then when we try
 	// to perform the insert there will be a violation of the UNIQUE "users_email_key"
 	// constraint that we set up in the previous chapter. We check for this error
 	// specifically, and return custom ErrDuplicateEmail error instead.
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := db.QueryRowContext(ctx, insertUserQuery, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"` ||
@@ -66,13 +156,52 @@ RETURNING id, created_at, version`
 	return nil
 }
 
-func (m UserModel) GetByEmail(email string) (*User, error) {
+func (m UserModel) Get(ctx context.Context, id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+SELECT id, created_at, name, email, password_hash, activated, version, role, locale
+FROM users
+WHERE id = $1`
+	var user User
+	ctx, span := startSpan(ctx, "UserModel.Get", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.Role,
+		&user.Locale,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-SELECT id, created_at, name, email, password_hash, activated, version
+SELECT id, created_at, name, email, password_hash, activated, version, role, locale
 FROM users
 WHERE email = $1`
 	var user User
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, span := startSpan(ctx, "UserModel.GetByEmail", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
@@ -82,6 +211,8 @@ WHERE email = $1`
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.Role,
+		&user.Locale,
 	)
 	if err != nil {
 		switch {
@@ -94,13 +225,13 @@ WHERE email = $1`
 	return &user, nil
 }
 
-func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
 	// Calculate the SHA-256 hash of the plaintext token provided by the client.
 	// Remember that this returns a byte *array* with length 32, not a slice.
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	// Set up the SQL query.
 	query := `
-SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version,users.role
+SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, users.role, users.locale
 FROM users
 INNER JOIN tokens
 ON users.id = tokens.user_id
@@ -112,7 +243,10 @@ AND tokens.expiry > $3`
 	// is not supported by the pq driver), and that we pass the current time as the
 	// value to check against the token expiry.
 	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, span := startSpan(ctx, "UserModel.GetForToken", query)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var user User
@@ -128,6 +262,7 @@ AND tokens.expiry > $3`
 		&user.Activated,
 		&user.Version,
 		&user.Role,
+		&user.Locale,
 	)
 	if err != nil {
 		switch {
@@ -141,23 +276,72 @@ AND tokens.expiry > $3`
 	return &user, nil
 }
 
-func (m UserModel) Update(user *User) error {
+func (m UserModel) Update(ctx context.Context, user *User) error {
+	ctx, span := startSpan(ctx, "UserModel.Update", updateUserQuery)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return updateUser(ctx, m.DB, user)
+}
+
+// Activate saves the user, who must have been marked as activated, deletes
+// their activation tokens and queues EventUserActivated, all in one
+// transaction.
+func (m UserModel) Activate(ctx context.Context, user *User) error {
 	query := `
+DELETE FROM tokens
+WHERE scope = $1 AND user_id = $2`
+
+	ctx, span := startSpan(ctx, "UserModel.Activate", updateUserQuery)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, ScopeActivation, user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = enqueueWebhookEvent(ctx, tx, EventUserActivated, user)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const updateUserQuery = `
 UPDATE users
-SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-WHERE id = $5 AND version = $6
+SET name = $1, email = $2, password_hash = $3, activated = $4, locale = $5, version = version + 1
+WHERE id = $6 AND version = $7
 RETURNING version`
+
+func updateUser(ctx context.Context, db rowQueryer, user *User) error {
 	args := []interface{}{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Locale,
 		user.ID,
 		user.Version,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+
+	err := db.QueryRowContext(ctx, updateUserQuery, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"` ||
@@ -214,10 +398,15 @@ func ValidateRole(v *validator.Validator, role string) {
 	v.Check(role == "admin" || role == "user", "role", "must be either 'admin' or 'user'")
 } //
 
+func ValidateLocale(v *validator.Validator, locale string) {
+	v.Check(validator.PermittedValue(locale, SupportedLocales...), "locale", "must be one of 'en', 'ru' or 'kk'")
+}
+
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Name != "", "name", "must be provided")
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
 	ValidateRole(v, user.Role)
+	ValidateLocale(v, user.Locale)
 	ValidateEmail(v, user.Email)
 
 	if user.Password.plaintext != nil {
@@ -0,0 +1,252 @@
+// Package dbtest provides a database/sql driver for tests that answers
+// queries with functions the test registers, so that code written against
+// *sql.DB can be tested without Postgres. It checks what the code asks the
+// database and what it does with the answers, not the SQL itself.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Rows is the result of a query.
+type Rows struct {
+	Columns []string
+	Values  [][]any
+}
+
+// QueryFunc answers a query that returns rows.
+type QueryFunc func(args []any) (*Rows, error)
+
+// ExecFunc answers a statement and returns the number of rows it affected.
+type ExecFunc func(args []any) (int64, error)
+
+type handler struct {
+	contains string
+	query    QueryFunc
+	exec     ExecFunc
+}
+
+// DB records the statements run against it and answers them with the first
+// handler whose text is contained in the statement, newest first.
+// Whitespace is collapsed in both before comparing them.
+type DB struct {
+	mu        sync.Mutex
+	handlers  []handler
+	statement []string
+	commits   int
+	rollbacks int
+}
+
+// New returns a *sql.DB backed by a new DB. It is closed when the test ends.
+func New(t testing.TB) (*sql.DB, *DB) {
+	t.Helper()
+
+	stub := &DB{}
+	db := sql.OpenDB(stub)
+	t.Cleanup(func() { db.Close() })
+
+	return db, stub
+}
+
+// Query answers queries containing contains with fn.
+func (d *DB) Query(contains string, fn QueryFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.handlers = append(d.handlers, handler{contains: normalize(contains), query: fn})
+}
+
+// Exec answers statements containing contains with fn.
+func (d *DB) Exec(contains string, fn ExecFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.handlers = append(d.handlers, handler{contains: normalize(contains), exec: fn})
+}
+
+// Statements returns every statement run so far, with whitespace collapsed.
+func (d *DB) Statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string(nil), d.statement...)
+}
+
+// Ran reports how many statements containing contains were run.
+func (d *DB) Ran(contains string) int {
+	contains = normalize(contains)
+	n := 0
+	for _, statement := range d.Statements() {
+		if strings.Contains(statement, contains) {
+			n++
+		}
+	}
+	return n
+}
+
+// Transactions returns how many transactions were committed and how many
+// rolled back.
+func (d *DB) Transactions() (commits, rollbacks int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.commits, d.rollbacks
+}
+
+var spaceRX = regexp.MustCompile(`\s+`)
+
+func normalize(query string) string {
+	return strings.TrimSpace(spaceRX.ReplaceAllString(query, " "))
+}
+
+func (d *DB) find(query string, wantQuery bool) (handler, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.statement = append(d.statement, query)
+
+	for i := len(d.handlers) - 1; i >= 0; i-- {
+		h := d.handlers[i]
+		if !strings.Contains(query, h.contains) {
+			continue
+		}
+		if (wantQuery && h.query != nil) || (!wantQuery && h.exec != nil) {
+			return h, nil
+		}
+	}
+
+	return handler{}, fmt.Errorf("dbtest: unexpected statement: %s", query)
+}
+
+func values(args []driver.NamedValue) []any {
+	v := make([]any, len(args))
+	for i, arg := range args {
+		v[i] = arg.Value
+	}
+	return v
+}
+
+// Connect and Driver make DB a driver.Connector.
+func (d *DB) Connect(context.Context) (driver.Conn, error) { return &conn{db: d}, nil }
+func (d *DB) Driver() driver.Driver                        { return stubDriver{d} }
+
+type stubDriver struct {
+	db *DB
+}
+
+func (s stubDriver) Open(string) (driver.Conn, error) { return &conn{db: s.db}, nil }
+
+type conn struct {
+	db *DB
+}
+
+func (c *conn) Prepare(string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c *conn) Close() error { return nil }
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return &tx{db: c.db}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return &tx{db: c.db}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	h, err := c.db.find(normalize(query), false)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := h.exec(values(args))
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	h, err := c.db.find(normalize(query), true)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := h.query(values(args))
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = &Rows{}
+	}
+
+	r := &rows{columns: result.Columns}
+	for _, row := range result.Values {
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			values[i] = v
+		}
+		r.values = append(r.values, values)
+	}
+	return r, nil
+}
+
+// CheckNamedValue accepts every argument as it is, so that handlers see
+// what the code passed rather than the conversion database/sql would make.
+// Values that implement driver.Valuer, such as pq.Array, are converted.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if valuer, ok := nv.Value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		nv.Value = v
+	}
+	return nil
+}
+
+type tx struct {
+	db *DB
+}
+
+func (t *tx) Commit() error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	t.db.commits++
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	t.db.rollbacks++
+	return nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
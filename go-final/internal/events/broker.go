@@ -0,0 +1,168 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+)
+
+// Subscription receives the events visible to one user. C is closed when the
+// subscriber falls too far behind or the broker shuts down; clients are
+// expected to reconnect with Last-Event-ID and catch up from the database.
+type Subscription struct {
+	C      <-chan *data.Event
+	ch     chan *data.Event
+	userID int64
+}
+
+// Broker listens for event notifications from Postgres and fans them out to
+// the subscriptions held by this API instance.
+type Broker struct {
+	listener *pq.Listener
+	events   data.EventModel
+	logger   *jsonlog.Logger
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+	done   chan struct{}
+}
+
+func NewBroker(dsn string, events data.EventModel, logger *jsonlog.Logger) (*Broker, error) {
+	b := &Broker{
+		events: events,
+		logger: logger,
+		subs:   make(map[*Subscription]struct{}),
+		done:   make(chan struct{}),
+	}
+
+	b.listener = pq.NewListener(dsn, time.Second, time.Minute, b.reportProblem)
+
+	err := b.listener.Listen(data.EventsChannel)
+	if err != nil {
+		b.listener.Close()
+		return nil, err
+	}
+
+	go b.run()
+
+	return b, nil
+}
+
+func (b *Broker) reportProblem(ev pq.ListenerEventType, err error) {
+	if err != nil {
+		b.logger.PrintError(err, map[string]string{
+			"component": "events",
+		})
+	}
+}
+
+func (b *Broker) run() {
+	for {
+		select {
+		case n, ok := <-b.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification means the connection was re-established and
+			// notifications may have been lost. Subscribers will catch up on
+			// their next reconnect.
+			if n == nil {
+				continue
+			}
+			b.dispatch(n.Extra)
+
+		case <-time.After(90 * time.Second):
+			go b.listener.Ping()
+
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *Broker) dispatch(payload string) {
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		b.logger.PrintError(err, map[string]string{"component": "events", "payload": payload})
+		return
+	}
+
+	event, err := b.events.Get(context.Background(), id)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			b.logger.PrintError(err, map[string]string{"component": "events"})
+		}
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if event.UserID != 0 && event.UserID != sub.userID {
+			continue
+		}
+
+		select {
+		case sub.ch <- event:
+		default:
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// Subscribe registers a new subscription for the user. If the broker is
+// already shutting down the returned channel is closed immediately.
+func (b *Broker) Subscribe(userID int64) *Subscription {
+	ch := make(chan *data.Event, 32)
+	sub := &Subscription{C: ch, ch: ch, userID: userID}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return sub
+	}
+
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Close stops listening and closes every subscription so that streaming
+// handlers return and the HTTP server can finish shutting down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+
+	close(b.done)
+	b.listener.Close()
+
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
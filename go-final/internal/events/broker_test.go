@@ -0,0 +1,109 @@
+package events
+
+import (
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/dbtest"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+)
+
+// newTestBroker returns a broker that isn't listening to Postgres, whose
+// events are looked up in a stub database holding one event per ID that
+// belongs to the user with the same ID, or to everyone for IDs over 100.
+func newTestBroker(t *testing.T) *Broker {
+	t.Helper()
+
+	db, stub := dbtest.New(t)
+	stub.Query("FROM events WHERE id = $1", func(args []any) (*dbtest.Rows, error) {
+		id := args[0].(int64)
+		userID := id
+		if id > 100 {
+			userID = 0
+		}
+		return &dbtest.Rows{
+			Columns: []string{"id", "created_at", "user_id", "type", "data"},
+			Values:  [][]any{{id, time.Now(), userID, "notification", []byte(`{}`)}},
+		}, nil
+	})
+
+	return &Broker{
+		events: data.EventModel{DB: db},
+		logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+		subs:   make(map[*Subscription]struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// received returns the IDs of the events waiting in sub.
+func received(sub *Subscription) []int64 {
+	var ids []int64
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, event.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	b := newTestBroker(t)
+
+	one := b.Subscribe(1)
+	two := b.Subscribe(2)
+
+	for _, payload := range []string{"1", "2", "101", "not an id"} {
+		b.dispatch(payload)
+	}
+
+	if got := received(one); len(got) != 2 || got[0] != 1 || got[1] != 101 {
+		t.Errorf("user 1 got events %v; want [1 101]", got)
+	}
+	if got := received(two); len(got) != 2 || got[0] != 2 || got[1] != 101 {
+		t.Errorf("user 2 got events %v; want [2 101]", got)
+	}
+}
+
+func TestDispatchDropsSlowSubscribers(t *testing.T) {
+	b := newTestBroker(t)
+
+	slow := b.Subscribe(1)
+	for i := 0; i <= cap(slow.ch); i++ {
+		b.dispatch(strconv.Itoa(101 + i))
+	}
+
+	if got := received(slow); len(got) != cap(slow.ch) {
+		t.Errorf("got %d events; want the %d that fit", len(got), cap(slow.ch))
+	}
+	if _, ok := <-slow.C; ok {
+		t.Error("subscription that fell behind wasn't closed")
+	}
+	if len(b.subs) != 0 {
+		t.Error("subscription that fell behind wasn't removed")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := newTestBroker(t)
+
+	sub := b.Subscribe(1)
+	b.Unsubscribe(sub)
+	b.Unsubscribe(sub)
+
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription wasn't closed")
+	}
+
+	b.dispatch("101")
+	if len(b.subs) != 0 {
+		t.Error("subscription wasn't removed")
+	}
+}
@@ -0,0 +1,429 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/jsonlog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/sbeknur/go-final/internal/jobs")
+
+// Job statuses.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// ErrUnknownKind is returned when enqueuing a job nobody handles.
+var ErrUnknownKind = errors.New("unknown job kind")
+
+// Handler runs a single job. Returning an error schedules a retry until the
+// job runs out of attempts. The context is cancelled if the queue is forced
+// to stop before the handler finishes.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+type Job struct {
+	ID          int64
+	Kind        string
+	Payload     json.RawMessage
+	Attempts    int
+	MaxAttempts int
+}
+
+type Config struct {
+	Concurrency  int
+	PollInterval time.Duration
+	// LockTimeout is how long a job may stay running before it is assumed
+	// that the worker running it died and another one may pick it up.
+	LockTimeout time.Duration
+	MaxAttempts int
+}
+
+// Queue stores jobs in Postgres and runs them with a bounded number of
+// workers. Any number of API instances may share the same table; each job is
+// claimed by exactly one of them with SELECT ... FOR UPDATE SKIP LOCKED.
+type Queue struct {
+	db       *sql.DB
+	logger   *jsonlog.Logger
+	cfg      Config
+	handlers map[string]Handler
+
+	slots  chan struct{}
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(db *sql.DB, logger *jsonlog.Logger, cfg Config) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Queue{
+		db:       db,
+		logger:   logger,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+		slots:    make(chan struct{}, cfg.Concurrency),
+		stop:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Handle registers the handler for a job kind. It must be called before
+// Start.
+func (q *Queue) Handle(kind string, handler Handler) {
+	q.handlers[kind] = handler
+}
+
+// Register is a typed wrapper around Handle that decodes the payload into T.
+func Register[T any](q *Queue, kind string, fn func(ctx context.Context, args T) error) {
+	q.Handle(kind, func(ctx context.Context, payload json.RawMessage) error {
+		var args T
+		err := json.Unmarshal(payload, &args)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, args)
+	})
+}
+
+// Enqueue stores a job to run as soon as a worker is free.
+func (q *Queue) Enqueue(ctx context.Context, kind string, args any) error {
+	return q.EnqueueAt(ctx, kind, args, time.Now())
+}
+
+func (q *Queue) EnqueueAt(ctx context.Context, kind string, args any, runAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return q.enqueue(ctx, q.db, kind, args, runAt)
+}
+
+// EnqueueTx stores a job as part of tx, so that it only runs if the change
+// that called for it is committed, and the change is rolled back if the job
+// can't be stored.
+func (q *Queue) EnqueueTx(ctx context.Context, tx *sql.Tx, kind string, args any) error {
+	return q.enqueue(ctx, tx, kind, args, time.Now())
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (q *Queue) enqueue(ctx context.Context, db execer, kind string, args any, runAt time.Time) error {
+	if _, ok := q.handlers[kind]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO jobs (kind, payload, max_attempts, run_at)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err = db.ExecContext(ctx, query, kind, payload, q.cfg.MaxAttempts, runAt)
+	return err
+}
+
+// Counts returns the number of jobs in each status. Succeeded and failed jobs
+// are only counted until DeleteFinished removes them.
+func (q *Queue) Counts(ctx context.Context) (map[string]int64, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM jobs GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int64{
+		StatusPending:   0,
+		StatusRunning:   0,
+		StatusSucceeded: 0,
+		StatusFailed:    0,
+	}
+
+	for rows.Next() {
+		var status string
+		var count int64
+		err := rows.Scan(&status, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// DeleteFinished removes jobs that succeeded or failed longer than
+// retention ago and returns how many were deleted. Pending and running jobs
+// are never deleted.
+func (q *Queue) DeleteFinished(ctx context.Context, retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM jobs
+		WHERE status IN ('succeeded', 'failed') AND finished_at < $1`
+
+	result, err := q.db.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Start begins polling for jobs in the background.
+func (q *Queue) Start() {
+	q.wg.Add(1)
+
+	go func() {
+		defer q.wg.Done()
+
+		ticker := time.NewTicker(q.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				q.poll()
+			case <-q.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops claiming new jobs and waits for running ones to finish. If ctx
+// expires first their contexts are cancelled; jobs that still don't finish
+// are retried by another worker once their lock times out.
+func (q *Queue) Stop(ctx context.Context) error {
+	close(q.stop)
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) poll() {
+	for {
+		free := cap(q.slots) - len(q.slots)
+		if free == 0 {
+			return
+		}
+
+		err := q.failAbandoned()
+		if err != nil {
+			q.logger.PrintError(err, map[string]string{"component": "jobs"})
+			return
+		}
+
+		jobs, err := q.claim(free)
+		if err != nil {
+			q.logger.PrintError(err, map[string]string{"component": "jobs"})
+			return
+		}
+
+		for _, job := range jobs {
+			q.slots <- struct{}{}
+			q.wg.Add(1)
+
+			go func(job *Job) {
+				defer q.wg.Done()
+				defer func() { <-q.slots }()
+				q.run(job)
+			}(job)
+		}
+
+		if len(jobs) < free {
+			return
+		}
+
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+	}
+}
+
+// failAbandoned marks jobs failed whose worker died during their last
+// attempt, since claim won't pick them up again.
+func (q *Queue) failAbandoned() error {
+	query := `
+		UPDATE jobs
+		SET status = 'failed', locked_at = NULL, last_error = 'lock timed out', finished_at = NOW()
+		WHERE status = 'running'
+		AND locked_at < NOW() - $1 * interval '1 second'
+		AND attempts >= max_attempts`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := q.db.ExecContext(ctx, query, q.cfg.LockTimeout.Seconds())
+	return err
+}
+
+// claim locks up to limit jobs that are due, along with jobs whose worker
+// died and that have attempts left, and counts an attempt for each.
+func (q *Queue) claim(limit int) ([]*Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'running', locked_at = NOW(), attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE (status = 'pending' AND run_at <= NOW())
+			OR (status = 'running' AND locked_at < NOW() - $2 * interval '1 second' AND attempts < max_attempts)
+			ORDER BY run_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, attempts, max_attempts`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := q.db.QueryContext(ctx, query, limit, q.cfg.LockTimeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		var job Job
+		err := rows.Scan(&job.ID, &job.Kind, &job.Payload, &job.Attempts, &job.MaxAttempts)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (q *Queue) run(job *Job) {
+	logger := q.logger.With(
+		"component", "jobs",
+		jsonlog.Int64("job_id", job.ID),
+		jsonlog.String("job_kind", job.Kind),
+		jsonlog.Int("attempt", job.Attempts),
+	)
+
+	err := q.execute(job)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+
+	err = q.finish(job, err)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+func (q *Queue) execute(job *Job) (err error) {
+	ctx, span := tracer.Start(q.ctx, "job "+job.Kind, trace.WithAttributes(
+		attribute.Int64("job.id", job.ID),
+		attribute.Int("job.attempt", job.Attempts),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKind, job.Kind)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, q.cfg.LockTimeout)
+	defer cancel()
+
+	return handler(ctx, job.Payload)
+}
+
+func (q *Queue) finish(job *Job, jobErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if jobErr == nil {
+		query := `
+			UPDATE jobs
+			SET status = 'succeeded', locked_at = NULL, last_error = '', finished_at = NOW()
+			WHERE id = $1`
+
+		_, err := q.db.ExecContext(ctx, query, job.ID)
+		return err
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		query := `
+			UPDATE jobs
+			SET status = 'failed', locked_at = NULL, last_error = $2, finished_at = NOW()
+			WHERE id = $1`
+
+		_, err := q.db.ExecContext(ctx, query, job.ID, jobErr.Error())
+		return err
+	}
+
+	query := `
+		UPDATE jobs
+		SET status = 'pending', locked_at = NULL, last_error = $2, run_at = $3
+		WHERE id = $1`
+
+	_, err := q.db.ExecContext(ctx, query, job.ID, jobErr.Error(), time.Now().Add(backoff(job.Attempts)))
+	return err
+}
+
+// backoff waits 10s after the first failure and doubles up to an hour.
+func backoff(attempt int) time.Duration {
+	delay := 10 * time.Second
+	for i := 1; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
@@ -0,0 +1,198 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/dbtest"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+)
+
+func newTestQueue(t *testing.T) (*Queue, *dbtest.DB) {
+	t.Helper()
+
+	db, stub := dbtest.New(t)
+	q := New(db, jsonlog.New(io.Discard, jsonlog.LevelOff), Config{
+		Concurrency:  2,
+		PollInterval: time.Second,
+		LockTimeout:  time.Minute,
+		MaxAttempts:  3,
+	})
+	return q, stub
+}
+
+func TestBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		3:  40 * time.Second,
+		8:  1280 * time.Second,
+		10: time.Hour,
+		50: time.Hour,
+	}
+
+	for attempt, want := range tests {
+		if got := backoff(attempt); got != want {
+			t.Errorf("attempt %d: got %s; want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	q, stub := newTestQueue(t)
+	Register(q, "greet", func(ctx context.Context, args struct{ Name string }) error { return nil })
+
+	var inserted []any
+	stub.Exec("INSERT INTO jobs", func(args []any) (int64, error) {
+		inserted = args
+		return 1, nil
+	})
+
+	err := q.Enqueue(context.Background(), "greet", struct{ Name string }{"Aigerim"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inserted[0] != "greet" || string(inserted[1].([]byte)) != `{"Name":"Aigerim"}` || inserted[2] != 3 {
+		t.Errorf("got insert %v", inserted)
+	}
+	if runAt := inserted[3].(time.Time); time.Since(runAt) > time.Second {
+		t.Errorf("got run_at %s; want now", runAt)
+	}
+
+	err = q.Enqueue(context.Background(), "unknown", nil)
+	if !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("got %v; want ErrUnknownKind", err)
+	}
+}
+
+// finished is how a job run ended, as recorded by finish.
+type finished struct {
+	status string
+	err    string
+	runAt  time.Time
+}
+
+// runClaimed has the queue claim the given jobs, run them and returns how
+// each of them finished by ID.
+func runClaimed(t *testing.T, q *Queue, stub *dbtest.DB, jobs ...Job) map[int64]finished {
+	t.Helper()
+
+	stub.Exec("attempts >= max_attempts", func(args []any) (int64, error) { return 0, nil })
+
+	claimed := false
+	stub.Query("SET status = 'running'", func(args []any) (*dbtest.Rows, error) {
+		rows := &dbtest.Rows{Columns: []string{"id", "kind", "payload", "attempts", "max_attempts"}}
+		if !claimed {
+			for _, job := range jobs {
+				rows.Values = append(rows.Values, []any{job.ID, job.Kind, []byte(job.Payload), int64(job.Attempts), int64(job.MaxAttempts)})
+			}
+			claimed = true
+		}
+		return rows, nil
+	})
+
+	var mu sync.Mutex
+	results := make(map[int64]finished)
+	record := func(status string) dbtest.ExecFunc {
+		return func(args []any) (int64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			f := finished{status: status}
+			if len(args) > 1 {
+				f.err = args[1].(string)
+			}
+			if len(args) > 2 {
+				f.runAt = args[2].(time.Time)
+			}
+			results[args[0].(int64)] = f
+			return 1, nil
+		}
+	}
+	stub.Exec("SET status = 'succeeded'", record(StatusSucceeded))
+	stub.Exec("SET status = 'failed', locked_at = NULL, last_error = $2", record(StatusFailed))
+	stub.Exec("SET status = 'pending'", record(StatusPending))
+
+	q.poll()
+	q.wg.Wait()
+
+	return results
+}
+
+func TestRun(t *testing.T) {
+	q, stub := newTestQueue(t)
+
+	var got []string
+	var mu sync.Mutex
+	Register(q, "greet", func(ctx context.Context, args struct{ Name string }) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		got = append(got, args.Name)
+		return nil
+	})
+
+	results := runClaimed(t, q, stub,
+		Job{ID: 1, Kind: "greet", Payload: json.RawMessage(`{"Name":"Aigerim"}`), Attempts: 1, MaxAttempts: 3},
+		Job{ID: 2, Kind: "greet", Payload: json.RawMessage(`{"Name":"Daniyar"}`), Attempts: 1, MaxAttempts: 3},
+	)
+
+	if len(got) != 2 {
+		t.Errorf("ran handler for %v; want both jobs", got)
+	}
+	for id := int64(1); id <= 2; id++ {
+		if results[id].status != StatusSucceeded {
+			t.Errorf("job %d: got %+v; want succeeded", id, results[id])
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	q, stub := newTestQueue(t)
+
+	q.Handle("flaky", func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("mail server unavailable")
+	})
+	q.Handle("broken", func(ctx context.Context, payload json.RawMessage) error {
+		panic("nil map")
+	})
+
+	results := runClaimed(t, q, stub,
+		Job{ID: 1, Kind: "flaky", Payload: json.RawMessage(`{}`), Attempts: 2, MaxAttempts: 3},
+		Job{ID: 2, Kind: "broken", Payload: json.RawMessage(`{}`), Attempts: 3, MaxAttempts: 3},
+	)
+
+	retry := results[1]
+	if retry.status != StatusPending || retry.err != "mail server unavailable" {
+		t.Errorf("job with attempts left: got %+v; want a pending retry", retry)
+	}
+	if wait := time.Until(retry.runAt); wait < backoff(2)-time.Second || wait > backoff(2) {
+		t.Errorf("job with attempts left: retried in %s; want %s", wait, backoff(2))
+	}
+
+	if failed := results[2]; failed.status != StatusFailed || !strings.Contains(failed.err, "panic: nil map") {
+		t.Errorf("job out of attempts: got %+v; want failed with the panic", failed)
+	}
+}
+
+func TestPollFailsAbandonedJobs(t *testing.T) {
+	q, stub := newTestQueue(t)
+	runClaimed(t, q, stub)
+
+	// Jobs whose worker died are only claimed again while they have attempts
+	// left; the others are failed before claiming.
+	statements := stub.Statements()
+	if len(statements) != 2 || !strings.Contains(statements[0], "SET status = 'failed'") || !strings.Contains(statements[0], "attempts >= max_attempts") {
+		t.Fatalf("got statements %q; want abandoned jobs failed first", statements)
+	}
+	if !strings.Contains(statements[1], "locked_at < NOW() - $2 * interval '1 second' AND attempts < max_attempts") {
+		t.Errorf("claim query doesn't limit reclaimed jobs to those with attempts left: %q", statements[1])
+	}
+}
@@ -0,0 +1,151 @@
+package jsonlog
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Field is a typed key/value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration is written in Go's duration notation, e.g. "1.5s".
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err records err's message under the "error" key.
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// Object nests fields under key.
+func Object(key string, fields ...Field) Field {
+	return Field{Key: key, Value: fields}
+}
+
+// Any records value as-is; it must be encodable as JSON.
+func Any(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// argsToFields turns the arguments to With into fields. Fields are used
+// directly; anything else is read as a key followed by its value.
+func argsToFields(args []any) []Field {
+	fields := make([]Field, 0, len(args))
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i].(type) {
+		case Field:
+			fields = append(fields, arg)
+		case string:
+			if i+1 < len(args) {
+				fields = append(fields, Field{Key: arg, Value: args[i+1]})
+				i++
+			} else {
+				fields = append(fields, Field{Key: "!BADKEY", Value: arg})
+			}
+		default:
+			fields = append(fields, Field{Key: "!BADKEY", Value: arg})
+		}
+	}
+
+	return fields
+}
+
+func propertiesToFields(properties map[string]string) []Field {
+	fields := make([]Field, 0, len(properties))
+	for key, value := range properties {
+		fields = append(fields, String(key, value))
+	}
+	return fields
+}
+
+// fieldsToMap builds the properties object. Later fields win over earlier
+// ones with the same key, so call site fields override bound ones; objects
+// with the same key are merged.
+func fieldsToMap(fields []Field) map[string]any {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	m := make(map[string]any, len(fields))
+	for _, f := range fields {
+		value := encodeValue(f.Value)
+
+		if obj, ok := value.(map[string]any); ok {
+			if prev, ok := m[f.Key].(map[string]any); ok {
+				for k, v := range obj {
+					prev[k] = v
+				}
+				continue
+			}
+		}
+
+		m[f.Key] = value
+	}
+	return m
+}
+
+func encodeValue(value any) any {
+	switch v := value.(type) {
+	case []Field:
+		return fieldsToMap(v)
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+type fieldsContextKey struct{}
+
+// ContextWithFields returns a copy of ctx carrying the fields in addition to
+// any it already had. The *Context logging methods add them to every entry.
+func ContextWithFields(ctx context.Context, fields ...Field) context.Context {
+	existing := FieldsFromContext(ctx)
+
+	all := make([]Field, 0, len(existing)+len(fields))
+	all = append(all, existing...)
+	all = append(all, fields...)
+
+	return context.WithValue(ctx, fieldsContextKey{}, all)
+}
+
+func FieldsFromContext(ctx context.Context) []Field {
+	fields, _ := ctx.Value(fieldsContextKey{}).([]Field)
+	return fields
+}
@@ -1,18 +1,24 @@
 package jsonlog
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -20,60 +26,249 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
 		return "FATAL"
+	case LevelOff:
+		return "OFF"
 	default:
 		return ""
 	}
 }
 
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// ParseLevel converts a level name such as "debug" or "WARN" to a Level.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	case "FATAL":
+		return LevelFatal, nil
+	case "OFF":
+		return LevelOff, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+type Options struct {
+	// MinLevel is the lowest level that is written.
+	MinLevel Level
+	// StackTraceLevel is the lowest level that gets a stack trace attached.
+	// Use LevelOff to never include one.
+	StackTraceLevel Level
+	// Sampling limits how many entries with a given message are written per
+	// second. See SetSampling.
+	Sampling map[string]int
+	// Redactor, if set, masks sensitive data in messages and fields.
+	Redactor *Redactor
+}
+
+// core is shared by a logger and all loggers derived from it with With, so
+// that they write to the same output under the same lock, and changes to the
+// level or sampling apply to all of them.
+type core struct {
+	out             io.Writer
+	mu              sync.Mutex
+	minLevel        atomic.Int32
+	stackTraceLevel Level
+	redactor        *Redactor
+
+	samplersMu sync.RWMutex
+	samplers   map[string]*sampler
+}
+
 type Logger struct {
-	out      io.Writer
-	minLevel Level
-	mu       sync.Mutex
+	core   *core
+	fields []Field
 }
 
+// New returns a logger that only includes stack traces on fatal errors. Use
+// NewWithOptions for control over stack traces.
 func New(out io.Writer, minLevel Level) *Logger {
+	return NewWithOptions(out, Options{
+		MinLevel:        minLevel,
+		StackTraceLevel: LevelFatal,
+	})
+}
+
+func NewWithOptions(out io.Writer, opts Options) *Logger {
+	l := &Logger{
+		core: &core{
+			out:             out,
+			stackTraceLevel: opts.StackTraceLevel,
+			redactor:        opts.Redactor,
+			samplers:        make(map[string]*sampler),
+		},
+	}
+
+	l.SetLevel(opts.MinLevel)
+	for message, perSecond := range opts.Sampling {
+		l.SetSampling(message, perSecond)
+	}
+
+	return l
+}
+
+// With returns a child logger that adds the given fields to every entry. It
+// accepts Fields as well as alternating keys and values, like log/slog:
+//
+//	logger.With("user_id", user.ID, jsonlog.Duration("took", d))
+func (l *Logger) With(args ...any) *Logger {
+	fields := make([]Field, 0, len(l.fields)+len(args))
+	fields = append(fields, l.fields...)
+	fields = append(fields, argsToFields(args)...)
+
 	return &Logger{
-		out:      out,
-		minLevel: minLevel,
+		core:   l.core,
+		fields: fields,
 	}
 }
 
+// Enabled reports whether entries at the level would be written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// Level returns the minimum level that is written.
+func (l *Logger) Level() Level {
+	return Level(l.core.minLevel.Load())
+}
+
+// SetLevel changes the minimum level at runtime. It applies to the logger and
+// every logger that shares its output.
+func (l *Logger) SetLevel(level Level) {
+	l.core.minLevel.Store(int32(level))
+}
+
+func (l *Logger) Debug(message string, fields ...Field) {
+	l.log(nil, LevelDebug, message, fields)
+}
+
+func (l *Logger) Info(message string, fields ...Field) {
+	l.log(nil, LevelInfo, message, fields)
+}
+
+func (l *Logger) Warn(message string, fields ...Field) {
+	l.log(nil, LevelWarn, message, fields)
+}
+
+func (l *Logger) Error(message string, fields ...Field) {
+	l.log(nil, LevelError, message, fields)
+}
+
+// Fatal writes the entry and exits the program.
+func (l *Logger) Fatal(message string, fields ...Field) {
+	l.log(nil, LevelFatal, message, fields)
+	os.Exit(1)
+}
+
+// The *Context variants also include any fields attached to ctx with
+// ContextWithFields, such as the request ID.
+func (l *Logger) DebugContext(ctx context.Context, message string, fields ...Field) {
+	l.log(ctx, LevelDebug, message, fields)
+}
+
+func (l *Logger) InfoContext(ctx context.Context, message string, fields ...Field) {
+	l.log(ctx, LevelInfo, message, fields)
+}
+
+func (l *Logger) WarnContext(ctx context.Context, message string, fields ...Field) {
+	l.log(ctx, LevelWarn, message, fields)
+}
+
+func (l *Logger) ErrorContext(ctx context.Context, message string, fields ...Field) {
+	l.log(ctx, LevelError, message, fields)
+}
+
+// PrintInfo, PrintError and PrintFatal predate typed fields and are kept for
+// the code that still uses them.
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
-	l.print(LevelInfo, message, properties)
+	l.log(nil, LevelInfo, message, propertiesToFields(properties))
 }
+
 func (l *Logger) PrintError(err error, properties map[string]string) {
-	l.print(LevelError, err.Error(), properties)
+	l.log(nil, LevelError, err.Error(), propertiesToFields(properties))
 }
+
 func (l *Logger) PrintFatal(err error, properties map[string]string) {
-	l.print(LevelFatal, err.Error(), properties)
+	l.log(nil, LevelFatal, err.Error(), propertiesToFields(properties))
 	os.Exit(1)
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
-		return 0, nil
+func (l *Logger) log(ctx context.Context, level Level, message string, fields []Field) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	// Fatal entries are never sampled; they are the last thing we write.
+	var suppressed int
+	if level < LevelFatal {
+		var ok bool
+		if ok, suppressed = l.core.sample(message); !ok {
+			return
+		}
+	}
+
+	var all []Field
+	all = append(all, l.fields...)
+	if ctx != nil {
+		all = append(all, FieldsFromContext(ctx)...)
 	}
+	all = append(all, fields...)
 
+	if suppressed > 0 {
+		all = append(all, Int("suppressed", suppressed))
+	}
+
+	l.print(level, message, all)
+}
+
+func (l *Logger) print(level Level, message string, fields []Field) (int, error) {
 	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
+		Level      string         `json:"level"`
+		Time       string         `json:"time"`
+		Message    string         `json:"message"`
+		Properties map[string]any `json:"properties,omitempty"`
+		Trace      string         `json:"trace,omitempty"`
 	}{
 		Level:      level.String(),
 		Time:       time.Now().UTC().Format(time.RFC3339),
 		Message:    message,
-		Properties: properties,
+		Properties: fieldsToMap(fields),
 	}
 
-	if level >= LevelError {
+	if r := l.core.redactor; r != nil {
+		aux.Message = r.String(aux.Message)
+		r.properties(aux.Properties)
+	}
+
+	if level >= l.core.stackTraceLevel {
 		aux.Trace = string(debug.Stack())
 	}
 
@@ -84,12 +279,17 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 		line = []byte(LevelError.String() + ": unable to marshal log message: " + err.Error())
 	}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
 
-	return l.out.Write(append(line, '\n'))
+	return l.core.out.Write(append(line, '\n'))
 }
 
+// Write lets the logger be used as the destination of a standard library
+// log.Logger, such as http.Server.ErrorLog.
 func (l *Logger) Write(message []byte) (n int, err error) {
-	return l.print(LevelError, string(message), nil)
+	if !l.Enabled(LevelError) {
+		return 0, nil
+	}
+	return l.print(LevelError, strings.TrimSpace(string(message)), l.fields)
 }
@@ -0,0 +1,196 @@
+package jsonlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+type entry struct {
+	Level      string
+	Message    string
+	Properties map[string]any
+	Trace      string
+}
+
+// entries decodes every line written to buf.
+func entries(t *testing.T, buf *bytes.Buffer) []entry {
+	t.Helper()
+
+	var all []entry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		all = append(all, e)
+	}
+	return all
+}
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelWarn)
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error")
+
+	got := entries(t, &buf)
+	if len(got) != 2 || got[0].Level != "WARN" || got[1].Level != "ERROR" {
+		t.Fatalf("got %+v; want the WARN and ERROR entries", got)
+	}
+
+	logger.SetLevel(LevelOff)
+	buf.Reset()
+	logger.Error("error")
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q with logging off", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal, LevelOff} {
+		got, err := ParseLevel(strings.ToLower(level.String()))
+		if err != nil || got != level {
+			t.Errorf("%s: got %s, %v", level, got, err)
+		}
+	}
+
+	if got, err := ParseLevel("warning"); err != nil || got != LevelWarn {
+		t.Errorf("warning: got %s, %v", got, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("got no error for an unknown level")
+	}
+}
+
+func TestFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelInfo).With("component", "jobs", Int("worker", 2))
+
+	ctx := ContextWithFields(context.Background(), String("request_id", "abc"))
+	logger.InfoContext(ctx, "job finished",
+		Duration("took", 1500*time.Millisecond),
+		Err(errors.New("boom")),
+		Object("job", Int64("id", 7), String("kind", "send_digest")),
+		Int("worker", 3),
+	)
+
+	got := entries(t, &buf)[0]
+	want := map[string]any{
+		"component":  "jobs",
+		"worker":     float64(3),
+		"request_id": "abc",
+		"took":       "1.5s",
+		"error":      "boom",
+		"job":        map[string]any{"id": float64(7), "kind": "send_digest"},
+	}
+
+	gotJSON, _ := json.Marshal(got.Properties)
+	wantJSON, _ := json.Marshal(want)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("got properties %s; want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewWithOptions(&buf, Options{MinLevel: LevelInfo, StackTraceLevel: LevelError})
+
+	logger.Warn("warn")
+	logger.Error("error")
+
+	got := entries(t, &buf)
+	if got[0].Trace != "" {
+		t.Error("WARN entry has a stack trace")
+	}
+	if !strings.Contains(got[1].Trace, "TestStackTraces") {
+		t.Errorf("ERROR entry has no stack trace: %q", got[1].Trace)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	s := &sampler{perSecond: 2}
+	start := time.Unix(1700000000, 0)
+
+	for i, want := range []bool{true, true, false, false} {
+		if ok, _ := s.allow(start.Add(time.Duration(i) * 100 * time.Millisecond)); ok != want {
+			t.Errorf("entry %d: got %t; want %t", i, ok, want)
+		}
+	}
+
+	ok, suppressed := s.allow(start.Add(time.Second))
+	if !ok || suppressed != 2 {
+		t.Errorf("next second: got %t with %d suppressed; want true with 2", ok, suppressed)
+	}
+}
+
+func TestSetSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelInfo)
+	logger.SetSampling("rate limiter failed", 1)
+
+	for i := 0; i < 5; i++ {
+		logger.Error("rate limiter failed")
+		logger.Error("other")
+	}
+
+	n := strings.Count(buf.String(), "rate limiter failed")
+	if n < 1 || n > 2 {
+		t.Errorf("wrote the sampled message %d times; want once per second", n)
+	}
+	if strings.Count(buf.String(), `"other"`) != 5 {
+		t.Error("sampled a message without a limit")
+	}
+
+	if got := logger.Sampling(); got["rate limiter failed"] != 1 || len(got) != 1 {
+		t.Errorf("got sampling %v", got)
+	}
+	logger.SetSampling("rate limiter failed", 0)
+	if got := logger.Sampling(); len(got) != 0 {
+		t.Errorf("got sampling %v after turning it off", got)
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(New(&buf, LevelInfo).Handler())
+
+	logger.Debug("hidden")
+	logger.With("service", "api").WithGroup("http").Warn("slow request", "path", "/v1/courses", slog.Int("status", 200))
+
+	got := entries(t, &buf)
+	if len(got) != 1 {
+		t.Fatalf("got %d entries; want 1", len(got))
+	}
+	if got[0].Level != "WARN" || got[0].Message != "slow request" {
+		t.Errorf("got %+v", got[0])
+	}
+
+	http, _ := got[0].Properties["http"].(map[string]any)
+	if got[0].Properties["service"] != "api" || http["path"] != "/v1/courses" || http["status"] != float64(200) {
+		t.Errorf("got properties %v", got[0].Properties)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelInfo).With("component", "http")
+
+	logger.Write([]byte("http: TLS handshake error\n"))
+
+	got := entries(t, &buf)[0]
+	if got.Level != "ERROR" || got.Message != "http: TLS handshake error" || got.Properties["component"] != "http" {
+		t.Errorf("got %+v", got)
+	}
+}
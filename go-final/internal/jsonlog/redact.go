@@ -0,0 +1,142 @@
+package jsonlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces masked values.
+const Redacted = "[REDACTED]"
+
+// Detector finds sensitive values inside strings. Matches are replaced using
+// Replace, which may refer to submatches as in regexp.Regexp.ReplaceAllString.
+type Detector struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Replace string
+}
+
+// Detectors holds the built-in detectors by name.
+var Detectors = map[string]Detector{
+	"bearer": {
+		Name:    "bearer",
+		Pattern: regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`),
+		Replace: "${1}" + Redacted,
+	},
+	// Authentication and activation tokens are 16 random bytes, base32
+	// encoded without padding.
+	"token": {
+		Name:    "token",
+		Pattern: regexp.MustCompile(`\b[A-Z2-7]{26}\b`),
+		Replace: Redacted,
+	},
+	"email": {
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		Replace: Redacted,
+	},
+	// Passwords and other secrets in query strings, form bodies and JSON,
+	// e.g. "?password=hunter2" or `"secret": "..."`.
+	"password": {
+		Name:    "password",
+		Pattern: regexp.MustCompile(`(?i)((?:password|passwd|pwd|secret|token|api[_-]?key)"?\s*[:=]\s*"?)[^\s&",;]+`),
+		Replace: "${1}" + Redacted,
+	},
+}
+
+// DefaultRedactKeys are the key patterns whose values are always masked.
+var DefaultRedactKeys = []string{
+	"password", "passwd", "secret", "token", "authorization", "cookie", "api[_-]?key", "dsn",
+}
+
+// Redactor masks sensitive data before it is written. Fields whose key
+// matches one of the key patterns are masked entirely; in every other string,
+// including the message, only the parts found by a detector are.
+type Redactor struct {
+	keys      *regexp.Regexp
+	detectors []Detector
+}
+
+// NewRedactor builds a redactor from case insensitive key patterns, which
+// match anywhere in a key, and the names of built-in detectors.
+func NewRedactor(keyPatterns []string, detectorNames []string) (*Redactor, error) {
+	r := &Redactor{}
+
+	if len(keyPatterns) > 0 {
+		keys, err := regexp.Compile(`(?i)` + strings.Join(keyPatterns, "|"))
+		if err != nil {
+			return nil, err
+		}
+		r.keys = keys
+	}
+
+	for _, name := range detectorNames {
+		d, ok := Detectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction detector %q", name)
+		}
+		r.detectors = append(r.detectors, d)
+	}
+
+	return r, nil
+}
+
+// AddDetector adds a custom detector. It must be called before the redactor
+// is used.
+func (r *Redactor) AddDetector(d Detector) {
+	r.detectors = append(r.detectors, d)
+}
+
+// String masks everything the detectors find in s.
+func (r *Redactor) String(s string) string {
+	for _, d := range r.detectors {
+		s = d.Pattern.ReplaceAllString(s, d.Replace)
+	}
+	return s
+}
+
+func (r *Redactor) sensitiveKey(key string) bool {
+	return r.keys != nil && r.keys.MatchString(key)
+}
+
+// properties masks the values of an encoded properties object in place. It
+// must only be given maps the logger owns; value copies the caller's.
+func (r *Redactor) properties(m map[string]any) {
+	for key, value := range m {
+		if r.sensitiveKey(key) {
+			m[key] = Redacted
+			continue
+		}
+		m[key] = r.value(value)
+	}
+}
+
+func (r *Redactor) value(value any) any {
+	switch v := value.(type) {
+	case string:
+		return r.String(v)
+	case map[string]any:
+		masked := make(map[string]any, len(v))
+		for key, item := range v {
+			masked[key] = item
+		}
+		r.properties(masked)
+		return masked
+	case map[string]string:
+		masked := make(map[string]any, len(v))
+		for key, s := range v {
+			masked[key] = s
+		}
+		r.properties(masked)
+		return masked
+	case []string:
+		masked := make([]string, len(v))
+		for i, s := range v {
+			masked[i] = r.String(s)
+		}
+		return masked
+	default:
+		return v
+	}
+}
@@ -0,0 +1,71 @@
+package jsonlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactorMasksFields(t *testing.T) {
+	r, err := NewRedactor(DefaultRedactKeys, []string{"bearer", "email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	logger := NewWithOptions(&buf, Options{MinLevel: LevelInfo, StackTraceLevel: LevelOff, Redactor: r})
+
+	logger.Info("signed in alice@example.com",
+		String("password", "hunter2"),
+		String("header", "Bearer abc.def"),
+		Any("nested", map[string]any{"api_key": "k", "note": "bob@example.com"}),
+	)
+
+	var entry struct {
+		Message    string
+		Properties map[string]any
+	}
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Message != "signed in "+Redacted {
+		t.Errorf("got message %q", entry.Message)
+	}
+	if entry.Properties["password"] != Redacted {
+		t.Errorf("got password %v", entry.Properties["password"])
+	}
+	if entry.Properties["header"] != "Bearer "+Redacted {
+		t.Errorf("got header %v", entry.Properties["header"])
+	}
+
+	nested := entry.Properties["nested"].(map[string]any)
+	if nested["api_key"] != Redacted || nested["note"] != Redacted {
+		t.Errorf("got nested %v", nested)
+	}
+}
+
+func TestRedactorLeavesCallerMapsAlone(t *testing.T) {
+	r, err := NewRedactor(DefaultRedactKeys, []string{"email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	logger := NewWithOptions(&buf, Options{MinLevel: LevelInfo, StackTraceLevel: LevelOff, Redactor: r})
+
+	payload := map[string]any{
+		"token": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+		"email": "alice@example.com",
+		"inner": map[string]any{"secret": "s"},
+	}
+	logger.Info("payload", Any("payload", payload))
+
+	if payload["token"] != "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU" || payload["email"] != "alice@example.com" {
+		t.Errorf("caller's map was changed: %v", payload)
+	}
+	if payload["inner"].(map[string]any)["secret"] != "s" {
+		t.Errorf("caller's nested map was changed: %v", payload["inner"])
+	}
+}
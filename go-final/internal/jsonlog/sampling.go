@@ -0,0 +1,87 @@
+package jsonlog
+
+import (
+	"sync"
+	"time"
+)
+
+// sampler lets through at most perSecond entries in each one second window
+// and counts the rest. The count is reported on the first entry let through
+// after them, so a burst that ends never reports its tail.
+type sampler struct {
+	perSecond int
+
+	mu         sync.Mutex
+	window     int64
+	count      int
+	suppressed int
+}
+
+func (s *sampler) allow(now time.Time) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sec := now.Unix(); sec != s.window {
+		s.window = sec
+		s.count = 0
+	}
+
+	if s.count >= s.perSecond {
+		s.suppressed++
+		return false, 0
+	}
+
+	s.count++
+
+	suppressed := s.suppressed
+	s.suppressed = 0
+	return true, suppressed
+}
+
+// SetSampling limits entries with the given message to perSecond per second.
+// Entries over the limit are dropped, and the next one written has a
+// "suppressed" field with how many were dropped since the last one. A
+// perSecond of zero or less turns sampling off for the message.
+func (l *Logger) SetSampling(message string, perSecond int) {
+	l.core.samplersMu.Lock()
+	defer l.core.samplersMu.Unlock()
+
+	if perSecond <= 0 {
+		delete(l.core.samplers, message)
+		return
+	}
+
+	if s, ok := l.core.samplers[message]; ok {
+		s.mu.Lock()
+		s.perSecond = perSecond
+		s.mu.Unlock()
+		return
+	}
+
+	l.core.samplers[message] = &sampler{perSecond: perSecond}
+}
+
+// Sampling returns the per second limits set with SetSampling.
+func (l *Logger) Sampling() map[string]int {
+	l.core.samplersMu.RLock()
+	defer l.core.samplersMu.RUnlock()
+
+	sampling := make(map[string]int, len(l.core.samplers))
+	for message, s := range l.core.samplers {
+		s.mu.Lock()
+		sampling[message] = s.perSecond
+		s.mu.Unlock()
+	}
+	return sampling
+}
+
+func (c *core) sample(message string) (bool, int) {
+	c.samplersMu.RLock()
+	s, ok := c.samplers[message]
+	c.samplersMu.RUnlock()
+
+	if !ok {
+		return true, 0
+	}
+	return s.allow(time.Now())
+}
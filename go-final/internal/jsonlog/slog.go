@@ -0,0 +1,130 @@
+package jsonlog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Handler returns a log/slog handler that writes through l, so libraries that
+// log with slog end up in the same stream:
+//
+//	slog.SetDefault(slog.New(logger.Handler()))
+func (l *Logger) Handler() slog.Handler {
+	return &slogHandler{logger: l}
+}
+
+type slogHandler struct {
+	logger *Logger
+	// groups holds the names opened with WithGroup. Attributes added after a
+	// group is opened are nested under it.
+	groups []string
+	attrs  []Field
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(fromSlogLevel(level))
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make([]Field, 0, len(h.attrs)+r.NumAttrs())
+	fields = append(fields, h.attrs...)
+
+	r.Attrs(func(a slog.Attr) bool {
+		fields = append(fields, attrToFields(a)...)
+		return true
+	})
+
+	h.logger.log(ctx, fromSlogLevel(r.Level), r.Message, h.nest(fields))
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var fields []Field
+	for _, a := range attrs {
+		fields = append(fields, attrToFields(a)...)
+	}
+
+	if len(h.groups) == 0 {
+		return &slogHandler{
+			logger: h.logger.With(fieldsToArgs(fields)...),
+		}
+	}
+
+	return &slogHandler{
+		logger: h.logger,
+		groups: h.groups,
+		attrs:  append(append([]Field{}, h.attrs...), fields...),
+	}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &slogHandler{
+		logger: h.logger.With(fieldsToArgs(h.nest(h.attrs))...),
+		groups: append(append([]string{}, h.groups...), name),
+	}
+}
+
+// nest wraps fields in the currently open groups, innermost last.
+func (h *slogHandler) nest(fields []Field) []Field {
+	if len(h.groups) == 0 || len(fields) == 0 {
+		return fields
+	}
+
+	for i := len(h.groups) - 1; i >= 0; i-- {
+		fields = []Field{Object(h.groups[i], fields...)}
+	}
+	return fields
+}
+
+// attrToFields converts an attribute following the slog.Handler rules: empty
+// attributes are dropped, and the members of a group with an empty key are
+// inlined.
+func attrToFields(a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+
+	if a.Equal(slog.Attr{}) {
+		return nil
+	}
+
+	if a.Value.Kind() != slog.KindGroup {
+		return []Field{{Key: a.Key, Value: a.Value.Any()}}
+	}
+
+	var fields []Field
+	for _, ga := range a.Value.Group() {
+		fields = append(fields, attrToFields(ga)...)
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	if a.Key == "" {
+		return fields
+	}
+	return []Field{Object(a.Key, fields...)}
+}
+
+func fieldsToArgs(fields []Field) []any {
+	args := make([]any, len(fields))
+	for i, f := range fields {
+		args[i] = f
+	}
+	return args
+}
+
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
@@ -0,0 +1,129 @@
+package mailer
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is used for recipients without a locale, and as the fallback
+// when a template has no translation for the requested locale.
+const DefaultLocale = "en"
+
+var monthNames = map[string][12]string{
+	"ru": {"января", "февраля", "марта", "апреля", "мая", "июня", "июля", "августа", "сентября", "октября", "ноября", "декабря"},
+	"kk": {"қаңтар", "ақпан", "наурыз", "сәуір", "мамыр", "маусым", "шілде", "тамыз", "қыркүйек", "қазан", "қараша", "желтоқсан"},
+}
+
+// durationUnits holds the singular, few and many forms of each unit. Only
+// Russian distinguishes all three; Kazakh nouns don't change after numerals.
+var durationUnits = map[string]map[string][3]string{
+	"en": {
+		"day":    {"day", "days", "days"},
+		"hour":   {"hour", "hours", "hours"},
+		"minute": {"minute", "minutes", "minutes"},
+	},
+	"ru": {
+		"day":    {"день", "дня", "дней"},
+		"hour":   {"час", "часа", "часов"},
+		"minute": {"минута", "минуты", "минут"},
+	},
+	"kk": {
+		"day":    {"күн", "күн", "күн"},
+		"hour":   {"сағат", "сағат", "сағат"},
+		"minute": {"минут", "минут", "минут"},
+	},
+}
+
+// templateFuncs returns the helpers available to every template. Besides
+// time.Time and time.Duration they accept RFC 3339 and Go duration strings,
+// so that previews can be rendered from plain JSON sample data.
+func templateFuncs(locale string) template.FuncMap {
+	return template.FuncMap{
+		"formatDate": func(v any) (string, error) {
+			switch t := v.(type) {
+			case time.Time:
+				return formatDate(locale, t), nil
+			case string:
+				parsed, err := time.Parse(time.RFC3339, t)
+				if err != nil {
+					return "", err
+				}
+				return formatDate(locale, parsed), nil
+			default:
+				return "", fmt.Errorf("formatDate: unsupported type %T", v)
+			}
+		},
+		"formatDuration": func(v any) (string, error) {
+			switch d := v.(type) {
+			case time.Duration:
+				return formatDuration(locale, d), nil
+			case string:
+				parsed, err := time.ParseDuration(d)
+				if err != nil {
+					return "", err
+				}
+				return formatDuration(locale, parsed), nil
+			default:
+				return "", fmt.Errorf("formatDuration: unsupported type %T", v)
+			}
+		},
+	}
+}
+
+func formatDate(locale string, t time.Time) string {
+	switch locale {
+	case "ru":
+		return fmt.Sprintf("%d %s %d", t.Day(), monthNames["ru"][t.Month()-1], t.Year())
+	case "kk":
+		return fmt.Sprintf("%d жылғы %d %s", t.Year(), t.Day(), monthNames["kk"][t.Month()-1])
+	default:
+		return t.Format("2 January 2006")
+	}
+}
+
+func formatDuration(locale string, d time.Duration) string {
+	units, ok := durationUnits[locale]
+	if !ok {
+		locale = DefaultLocale
+		units = durationUnits[locale]
+	}
+
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+
+	var parts []string
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", days, pluralForm(locale, units["day"], days)))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", hours, pluralForm(locale, units["hour"], hours)))
+	}
+	if minutes > 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", minutes, pluralForm(locale, units["minute"], minutes)))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// pluralForm picks between the singular, few and many forms. Russian has
+// its own rules; everything else uses the singular for exactly one.
+func pluralForm(locale string, forms [3]string, n int) string {
+	if locale != "ru" {
+		if n == 1 {
+			return forms[0]
+		}
+		return forms[2]
+	}
+
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return forms[0]
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 10 || n%100 >= 20):
+		return forms[1]
+	default:
+		return forms[2]
+	}
+}
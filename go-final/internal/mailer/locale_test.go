@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPluralForm(t *testing.T) {
+	forms := [3]string{"one", "few", "many"}
+
+	tests := []struct {
+		locale string
+		n      int
+		want   string
+	}{
+		{"en", 0, "many"},
+		{"en", 1, "one"},
+		{"en", 2, "many"},
+		{"en", 21, "many"},
+		{"kk", 1, "one"},
+		{"kk", 5, "many"},
+		{"ru", 0, "many"},
+		{"ru", 1, "one"},
+		{"ru", 2, "few"},
+		{"ru", 4, "few"},
+		{"ru", 5, "many"},
+		{"ru", 11, "many"},
+		{"ru", 12, "many"},
+		{"ru", 14, "many"},
+		{"ru", 21, "one"},
+		{"ru", 22, "few"},
+		{"ru", 25, "many"},
+		{"ru", 101, "one"},
+		{"ru", 111, "many"},
+		{"ru", 112, "many"},
+		{"ru", 122, "few"},
+	}
+
+	for _, tt := range tests {
+		got := pluralForm(tt.locale, forms, tt.n)
+		if got != tt.want {
+			t.Errorf("pluralForm(%q, %d) = %q; want %q", tt.locale, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		locale string
+		d      time.Duration
+		want   string
+	}{
+		{"en", 72 * time.Hour, "3 days"},
+		{"en", 25*time.Hour + 30*time.Minute, "1 day 1 hour 30 minutes"},
+		{"en", 0, "0 minutes"},
+		{"ru", 72 * time.Hour, "3 дня"},
+		{"ru", 5 * 24 * time.Hour, "5 дней"},
+		{"ru", 21*time.Hour + time.Minute, "21 час 1 минута"},
+		{"kk", 7 * 24 * time.Hour, "7 күн"},
+		{"fr", 2 * time.Hour, "2 hours"},
+	}
+
+	for _, tt := range tests {
+		got := formatDuration(tt.locale, tt.d)
+		if got != tt.want {
+			t.Errorf("formatDuration(%q, %s) = %q; want %q", tt.locale, tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]string{
+		"en": "1 March 2023",
+		"ru": "1 марта 2023",
+		"kk": "2023 жылғы 1 наурыз",
+		"":   "1 March 2023",
+	}
+
+	for locale, want := range tests {
+		got := formatDate(locale, date)
+		if got != want {
+			t.Errorf("formatDate(%q) = %q; want %q", locale, got, want)
+		}
+	}
+}
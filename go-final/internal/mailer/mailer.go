@@ -2,66 +2,286 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"html/template"
-	"time"
+	"io/fs"
+	"sort"
+	"strings"
+	texttemplate "text/template"
 
-	"github.com/go-mail/mail/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-//go:embed templates/*
+//go:embed templates/* partials/*
 var templateFS embed.FS
 
+var tracer = otel.Tracer("github.com/sbeknur/go-final/internal/mailer")
+
 type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+	transport    Transport
+	sender       string
+	preferences  Preferences
+	unsubscriber *Unsubscriber
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
+// Recipient identifies who an email is for. UserID is used for notification
+// preferences and unsubscribe links and may be zero for ad-hoc addresses.
+type Recipient struct {
+	UserID int64
+	Email  string
+	Locale string
+}
 
+func New(transport Transport, sender string) Mailer {
 	return Mailer{
-		dialer: dialer,
-		sender: sender,
+		transport: transport,
+		sender:    sender,
 	}
 }
 
-func (m Mailer) Send(recipient, templateFile string, data any) error {
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+// WithUnsubscribe returns a copy of the mailer that skips categories the
+// recipient opted out of and adds unsubscribe links to optional emails.
+func (m Mailer) WithUnsubscribe(preferences Preferences, unsubscriber *Unsubscriber) Mailer {
+	m.preferences = preferences
+	m.unsubscriber = unsubscriber
+	return m
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Send renders templateFile in the recipient's locale and delivers it. For a
+// templateFile of "user_welcome.tmpl" and locale "ru" it looks for
+// "user_welcome.ru.tmpl" first and falls back to "user_welcome.tmpl".
+//
+// Templates may define a "category" block naming the notification category
+// they belong to. Emails without one are transactional and always sent.
+func (m Mailer) Send(ctx context.Context, recipient Recipient, templateFile string, data any) (err error) {
+	ctx, span := tracer.Start(ctx, "Mailer.Send", trace.WithAttributes(
+		attribute.String("mail.template", templateFile),
+		attribute.String("mail.locale", recipient.Locale),
+	))
+	defer func() { endSpan(span, err) }()
+
+	msg, category, err := m.render(recipient, templateFile, data)
 	if err != nil {
 		return err
 	}
 
+	if category != "" && m.preferences != nil && recipient.UserID != 0 {
+		span.SetAttributes(attribute.String("mail.category", category))
+
+		enabled, err := m.preferences.EmailEnabled(ctx, recipient.UserID, category)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			span.SetAttributes(attribute.Bool("mail.skipped", true))
+			return nil
+		}
+	}
+
+	return m.Deliver(ctx, msg)
+}
+
+// Render executes the subject, plainBody and htmlBody templates without
+// sending anything. Referencing a key that is missing from a map passed as
+// data is an error rather than a silent "<no value>".
+func (m Mailer) Render(recipient Recipient, templateFile string, data any) (*Message, error) {
+	msg, _, err := m.render(recipient, templateFile, data)
+	return msg, err
+}
+
+func (m Mailer) render(recipient Recipient, templateFile string, data any) (*Message, string, error) {
+	locale := recipient.Locale
+	if locale == "" {
+		locale = DefaultLocale
+	}
+
+	path := templatePath("templates", templateFile, locale)
+	partials := templatePath("partials", "unsubscribe.tmpl", locale)
+	funcs := templateFuncs(locale)
+
+	// The same files are parsed twice: text/template for the parts that
+	// aren't HTML, so that quotes and angle brackets in them are left alone,
+	// and html/template for the HTML body.
+	textTmpl, err := texttemplate.New("email").Funcs(texttemplate.FuncMap(funcs)).Option("missingkey=error").ParseFS(templateFS, path, partials)
+	if err != nil {
+		return nil, "", err
+	}
+
+	htmlTmpl, err := template.New("email").Funcs(funcs).Option("missingkey=error").ParseFS(templateFS, path, partials)
+	if err != nil {
+		return nil, "", err
+	}
+
+	category := new(bytes.Buffer)
+	if textTmpl.Lookup("category") != nil {
+		err = textTmpl.ExecuteTemplate(category, "category", data)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
 	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	err = textTmpl.ExecuteTemplate(subject, "subject", data)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
 	plainBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	err = textTmpl.ExecuteTemplate(plainBody, "plainBody", data)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
 	htmlBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
+	msg := &Message{
+		To:        recipient.Email,
+		From:      m.sender,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}
+
+	categoryName := strings.TrimSpace(category.String())
+	if categoryName != "" && m.unsubscriber != nil {
+		err = addUnsubscribe(msg, textTmpl, htmlTmpl, m.unsubscriber.URL(recipient.UserID, categoryName))
+		if err != nil {
+			return nil, "", err
+		}
+	}
 
-	err = m.dialer.DialAndSend(msg)
+	return msg, categoryName, nil
+}
+
+// addUnsubscribe appends the unsubscribe footer from the partials, in the
+// recipient's locale, to both bodies and sets the RFC 8058 headers so that
+// mail clients can offer one-click unsubscribe.
+func addUnsubscribe(msg *Message, textTmpl *texttemplate.Template, htmlTmpl *template.Template, link string) error {
+	data := map[string]any{"unsubscribeURL": link}
+
+	plainFooter := new(bytes.Buffer)
+	err := textTmpl.ExecuteTemplate(plainFooter, "unsubscribePlain", data)
 	if err != nil {
 		return err
 	}
 
+	htmlFooter := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlFooter, "unsubscribeHTML", data)
+	if err != nil {
+		return err
+	}
+
+	msg.Headers = map[string]string{
+		"List-Unsubscribe":      "<" + link + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+
+	msg.PlainBody += plainFooter.String()
+
+	footer := htmlFooter.String()
+	if idx := strings.LastIndex(msg.HTMLBody, "</body>"); idx >= 0 {
+		msg.HTMLBody = msg.HTMLBody[:idx] + footer + "\n" + msg.HTMLBody[idx:]
+	} else {
+		msg.HTMLBody += footer
+	}
+
 	return nil
 }
+
+// Deliver hands an already rendered message to the transport.
+func (m Mailer) Deliver(ctx context.Context, msg *Message) (err error) {
+	_, span := tracer.Start(ctx, "Mailer.Deliver")
+	defer func() { endSpan(span, err) }()
+
+	return m.transport.Send(msg)
+}
+
+// Templates returns the names of all embedded templates, without locale
+// suffixes, along with the locales each one has a translation for.
+func Templates() (map[string][]string, error) {
+	entries, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make(map[string][]string)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".tmpl")
+		base, locale, found := strings.Cut(name, ".")
+		if !found {
+			locale = DefaultLocale
+		}
+		templates[base+".tmpl"] = append(templates[base+".tmpl"], locale)
+	}
+
+	for _, locales := range templates {
+		sort.Strings(locales)
+	}
+
+	return templates, nil
+}
+
+func templatePath(dir, templateFile, locale string) string {
+	localized := dir + "/" + strings.TrimSuffix(templateFile, ".tmpl") + "." + locale + ".tmpl"
+
+	if _, err := fs.Stat(templateFS, localized); err == nil {
+		return localized
+	}
+
+	return dir + "/" + templateFile
+}
+
+// sampleData holds representative data for each template, used by previews
+// when the caller doesn't supply any.
+var sampleData = map[string]map[string]any{
+	"user_welcome.tmpl": {
+		"activationToken":  "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+		"activationTTL":    "72h",
+		"activationExpiry": "2023-03-01T12:00:00Z",
+		"userID":           42,
+	},
+	"invitation.tmpl": {
+		"inviterName":      "Aigerim",
+		"role":             "admin",
+		"email":            "daniyar@example.com",
+		"invitationToken":  "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+		"invitationTTL":    "168h",
+		"invitationExpiry": "2023-03-01T12:00:00Z",
+	},
+	"course_update.tmpl": {
+		"userName":    "Aigerim",
+		"courseID":    7,
+		"courseTitle": "Introduction to Go",
+	},
+	"digest.tmpl": {
+		"userName":    "Aigerim",
+		"unreadCount": 3,
+		"titles":      []string{`Course "Introduction to Go" was updated`, `Course "Databases" was updated`},
+	},
+}
+
+// SampleData returns the sample data for templateFile, or an empty map if
+// there is none.
+func SampleData(templateFile string) map[string]any {
+	data, ok := sampleData[templateFile]
+	if !ok {
+		return map[string]any{}
+	}
+	return data
+}
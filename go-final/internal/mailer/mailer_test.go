@@ -0,0 +1,89 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderEscaping(t *testing.T) {
+	m := New(nil, "ProEdu <no-reply@example.com>")
+
+	data := map[string]any{
+		"userName":    "Aigerim",
+		"courseID":    7,
+		"courseTitle": `<Go> & "Friends"`,
+	}
+
+	msg, err := m.Render(Recipient{Email: "aigerim@example.com"}, "course_update.tmpl", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, body := range map[string]string{"subject": msg.Subject, "plain body": msg.PlainBody} {
+		if !strings.Contains(body, `<Go> & "Friends"`) {
+			t.Errorf("%s doesn't contain the title as it is: %q", name, body)
+		}
+	}
+
+	if strings.Contains(msg.HTMLBody, "<Go>") || !strings.Contains(msg.HTMLBody, "&lt;Go&gt; &amp; &#34;Friends&#34;") {
+		t.Errorf("HTML body doesn't contain the escaped title: %q", msg.HTMLBody)
+	}
+}
+
+func TestRenderLocales(t *testing.T) {
+	m := New(nil, "ProEdu <no-reply@example.com>")
+
+	templates, err := Templates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for templateFile, locales := range templates {
+		for _, locale := range locales {
+			msg, err := m.Render(Recipient{Email: "aigerim@example.com", Locale: locale}, templateFile, SampleData(templateFile))
+			if err != nil {
+				t.Errorf("%s in %s: %v", templateFile, locale, err)
+				continue
+			}
+			if msg.Subject == "" || msg.PlainBody == "" || msg.HTMLBody == "" {
+				t.Errorf("%s in %s: rendered an empty part", templateFile, locale)
+			}
+		}
+	}
+}
+
+func TestRenderMissingKey(t *testing.T) {
+	m := New(nil, "ProEdu <no-reply@example.com>")
+
+	_, err := m.Render(Recipient{Email: "aigerim@example.com"}, "course_update.tmpl", map[string]any{})
+	if err == nil {
+		t.Error("got no error rendering without data")
+	}
+}
+
+func TestRenderUnsubscribeFooter(t *testing.T) {
+	unsubscriber := NewUnsubscriber("secret", "https://api.example.com/")
+	m := New(nil, "ProEdu <no-reply@example.com>").WithUnsubscribe(nil, unsubscriber)
+
+	tests := map[string]string{
+		"en": "To stop receiving these emails",
+		"ru": "Чтобы больше не получать такие письма",
+		"kk": "Мұндай хаттарды алмау үшін",
+	}
+
+	for locale, footer := range tests {
+		recipient := Recipient{UserID: 2, Email: "aigerim@example.com", Locale: locale}
+		msg, err := m.Render(recipient, "course_update.tmpl", SampleData("course_update.tmpl"))
+		if err != nil {
+			t.Fatalf("%s: %v", locale, err)
+		}
+
+		link := unsubscriber.URL(2, "course_updates")
+		if !strings.Contains(msg.PlainBody, footer) || !strings.Contains(msg.PlainBody, link) {
+			t.Errorf("%s: plain body has no localized footer with the link: %q", locale, msg.PlainBody)
+		}
+		if !strings.Contains(msg.HTMLBody, footer) || !strings.Contains(msg.HTMLBody, `href="`+strings.ReplaceAll(link, "&", "&amp;")+`"`) {
+			t.Errorf("%s: HTML body has no localized footer with the link: %q", locale, msg.HTMLBody)
+		}
+	}
+}
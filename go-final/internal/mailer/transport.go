@@ -0,0 +1,159 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// Message is a fully rendered email, ready to be handed to a Transport.
+type Message struct {
+	To        string
+	From      string
+	Subject   string
+	Headers   map[string]string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Transport delivers rendered messages. Implementations must be safe for
+// concurrent use, since emails are sent from background goroutines.
+type Transport interface {
+	Send(msg *Message) error
+}
+
+func (msg *Message) toMail() *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	for key, value := range msg.Headers {
+		m.SetHeader(key, value)
+	}
+	m.SetDateHeader("Date", time.Now())
+	m.SetBody("text/plain", msg.PlainBody)
+	if msg.HTMLBody != "" {
+		m.AddAlternative("text/html", msg.HTMLBody)
+	}
+	return m
+}
+
+// SMTPTransport sends messages through an SMTP server.
+type SMTPTransport struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTPTransport(host string, port int, username, password string) *SMTPTransport {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPTransport{dialer: dialer}
+}
+
+func (t *SMTPTransport) Send(msg *Message) error {
+	return t.dialer.DialAndSend(msg.toMail())
+}
+
+// FileTransport writes every message as an .eml file into a directory, which
+// is handy in development where the files can be opened in any mail client.
+type FileTransport struct {
+	dir string
+}
+
+func NewFileTransport(dir string) (*FileTransport, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileTransport{dir: dir}, nil
+}
+
+func (t *FileTransport) Send(msg *Message) error {
+	f, err := os.CreateTemp(t.dir, fmt.Sprintf("%s-*.eml", time.Now().UTC().Format("20060102T150405")))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = msg.toMail().WriteTo(f)
+	return err
+}
+
+// WriterTransport writes every message in RFC 5322 form to an io.Writer, such
+// as os.Stdout.
+type WriterTransport struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+func NewWriterTransport(out io.Writer) *WriterTransport {
+	return &WriterTransport{out: out}
+}
+
+func (t *WriterTransport) Send(msg *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, err := msg.toMail().WriteTo(t.out)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(t.out, "\r\n")
+	return err
+}
+
+// MemoryTransport keeps sent messages in memory so that tests can inspect
+// them, for example to pull the activation token out of a welcome email.
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Send(msg *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of all messages sent so far.
+func (t *MemoryTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	messages := make([]Message, len(t.messages))
+	copy(messages, t.messages)
+	return messages
+}
+
+// Last returns the most recently sent message to the recipient, if any.
+func (t *MemoryTransport) Last(recipient string) (Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := len(t.messages) - 1; i >= 0; i-- {
+		if t.messages[i].To == recipient {
+			return t.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// Reset discards all captured messages.
+func (t *MemoryTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = nil
+}
@@ -0,0 +1,224 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testMessage = &Message{
+	To:        "aigerim@example.com",
+	From:      "ProEdu <no-reply@example.com>",
+	Subject:   "Welcome",
+	Headers:   map[string]string{"List-Unsubscribe": "<https://example.com/unsubscribe>"},
+	PlainBody: "Hi Aigerim",
+	HTMLBody:  "<p>Hi Aigerim</p>",
+}
+
+func checkRFC5322(t *testing.T, b []byte) {
+	t.Helper()
+
+	for _, want := range []string{
+		"To: aigerim@example.com",
+		"Subject: Welcome",
+		"List-Unsubscribe: <https://example.com/unsubscribe>",
+		"Content-Type: text/plain",
+		"Content-Type: text/html",
+		"Hi Aigerim",
+		"<p>Hi Aigerim</p>",
+	} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Errorf("message doesn't contain %q:\n%s", want, b)
+		}
+	}
+}
+
+func TestWriterTransport(t *testing.T) {
+	var buf bytes.Buffer
+	transport := NewWriterTransport(&buf)
+
+	err := transport.Send(testMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRFC5322(t, buf.Bytes())
+}
+
+func TestFileTransport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+
+	transport, err := NewFileTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = transport.Send(testMessage)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d .eml files; want 2", len(files))
+	}
+
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRFC5322(t, b)
+}
+
+func TestMemoryTransport(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	for i, to := range []string{"a@example.com", "b@example.com", "a@example.com"} {
+		err := transport.Send(&Message{To: to, Subject: fmt.Sprintf("message %d", i+1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := transport.Messages()
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages; want 3", len(messages))
+	}
+	messages[0].Subject = "changed"
+	if transport.Messages()[0].Subject == "changed" {
+		t.Error("Messages doesn't return a copy")
+	}
+
+	msg, ok := transport.Last("a@example.com")
+	if !ok || msg.Subject != "message 3" {
+		t.Errorf("got last message %+v, %t; want the third one", msg, ok)
+	}
+	if _, ok := transport.Last("c@example.com"); ok {
+		t.Error("found a message for a recipient who got none")
+	}
+
+	transport.Reset()
+	if len(transport.Messages()) != 0 {
+		t.Error("messages are left after Reset")
+	}
+}
+
+// testPreferences opts users out of the categories listed for them.
+type testPreferences map[int64][]string
+
+func (p testPreferences) EmailEnabled(ctx context.Context, userID int64, category string) (bool, error) {
+	if userID == 666 {
+		return false, errors.New("database is down")
+	}
+	for _, c := range p[userID] {
+		if c == category {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func TestSend(t *testing.T) {
+	transport := NewMemoryTransport()
+	unsubscriber := NewUnsubscriber("secret", "https://api.example.com/")
+	m := New(transport, "ProEdu <no-reply@example.com>").
+		WithUnsubscribe(testPreferences{2: {"course_updates"}}, unsubscriber)
+
+	ctx := context.Background()
+	courseData := SampleData("course_update.tmpl")
+
+	tests := []struct {
+		name         string
+		recipient    Recipient
+		templateFile string
+		wantErr      bool
+		wantSent     bool
+		wantFooter   bool
+	}{
+		{
+			name:         "optional email",
+			recipient:    Recipient{UserID: 1, Email: "one@example.com"},
+			templateFile: "course_update.tmpl",
+			wantSent:     true,
+			wantFooter:   true,
+		},
+		{
+			name:         "opted out",
+			recipient:    Recipient{UserID: 2, Email: "two@example.com"},
+			templateFile: "course_update.tmpl",
+		},
+		{
+			name:         "transactional email to someone who opted out",
+			recipient:    Recipient{UserID: 2, Email: "two@example.com", Locale: "ru"},
+			templateFile: "user_welcome.tmpl",
+			wantSent:     true,
+		},
+		{
+			name:         "ad-hoc address",
+			recipient:    Recipient{Email: "guest@example.com"},
+			templateFile: "course_update.tmpl",
+			wantSent:     true,
+			wantFooter:   true,
+		},
+		{
+			name:         "preferences fail",
+			recipient:    Recipient{UserID: 666, Email: "broken@example.com"},
+			templateFile: "course_update.tmpl",
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport.Reset()
+
+			data := courseData
+			if tt.templateFile != "course_update.tmpl" {
+				data = SampleData(tt.templateFile)
+			}
+
+			err := m.Send(ctx, tt.recipient, tt.templateFile, data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+
+			msg, sent := transport.Last(tt.recipient.Email)
+			if sent != tt.wantSent {
+				t.Fatalf("sent %t; want %t", sent, tt.wantSent)
+			}
+			if !sent {
+				return
+			}
+
+			hasFooter := strings.Contains(msg.PlainBody, "To stop receiving these emails")
+			if hasFooter != tt.wantFooter {
+				t.Errorf("got footer %t; want %t", hasFooter, tt.wantFooter)
+			}
+			if !tt.wantFooter {
+				return
+			}
+
+			if msg.Headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+				t.Errorf("got headers %v", msg.Headers)
+			}
+
+			link := strings.Trim(msg.Headers["List-Unsubscribe"], "<>")
+			if !strings.HasPrefix(link, "https://api.example.com/v1/notifications/unsubscribe?token=") {
+				t.Errorf("got unsubscribe link %q", link)
+			}
+			if link != unsubscriber.URL(tt.recipient.UserID, "course_updates") {
+				t.Errorf("got link %q; want the one for user %d and course_updates", link, tt.recipient.UserID)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// Preferences reports whether a user still wants emails in a category.
+type Preferences interface {
+	EmailEnabled(ctx context.Context, userID int64, category string) (bool, error)
+}
+
+// Unsubscriber creates and verifies signed one-click unsubscribe links. The
+// token is "<user id>.<category>.<signature>" so it needs no database lookup.
+type Unsubscriber struct {
+	secret  []byte
+	baseURL string
+}
+
+func NewUnsubscriber(secret, baseURL string) *Unsubscriber {
+	return &Unsubscriber{
+		secret:  []byte(secret),
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (u *Unsubscriber) Token(userID int64, category string) string {
+	payload := strconv.FormatInt(userID, 10) + "." + category
+	return payload + "." + u.sign(payload)
+}
+
+func (u *Unsubscriber) URL(userID int64, category string) string {
+	return fmt.Sprintf("%s/v1/notifications/unsubscribe?token=%s", u.baseURL, url.QueryEscape(u.Token(userID, category)))
+}
+
+// Verify checks the signature on token and returns the user ID and category
+// it was issued for.
+func (u *Unsubscriber) Verify(token string) (int64, string, error) {
+	idx := strings.LastIndex(token, ".")
+	if idx < 0 {
+		return 0, "", ErrInvalidUnsubscribeToken
+	}
+	payload, signature := token[:idx], token[idx+1:]
+
+	if !hmac.Equal([]byte(signature), []byte(u.sign(payload))) {
+		return 0, "", ErrInvalidUnsubscribeToken
+	}
+
+	id, category, found := strings.Cut(payload, ".")
+	if !found {
+		return 0, "", ErrInvalidUnsubscribeToken
+	}
+
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || userID < 1 {
+		return 0, "", ErrInvalidUnsubscribeToken
+	}
+
+	return userID, category, nil
+}
+
+func (u *Unsubscriber) sign(payload string) string {
+	mac := hmac.New(sha256.New, u.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	u := NewUnsubscriber("secret", "https://api.example.com")
+
+	token := u.Token(42, "course_updates")
+
+	userID, category, err := u.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != 42 || category != "course_updates" {
+		t.Errorf("got %d, %q; want 42, course_updates", userID, category)
+	}
+
+	if u.Token(42, "course_updates") != token {
+		t.Error("got a different token for the same user and category")
+	}
+}
+
+func TestUnsubscribeTokenInvalid(t *testing.T) {
+	u := NewUnsubscriber("secret", "https://api.example.com")
+	token := u.Token(42, "course_updates")
+	signature := token[strings.LastIndex(token, ".")+1:]
+
+	tests := map[string]string{
+		"empty":              "",
+		"no signature":       "42.course_updates",
+		"other user":         strings.Replace(token, "42.", "43.", 1),
+		"other category":     strings.Replace(token, "course_updates", "digest", 1),
+		"truncated":          token[:len(token)-1],
+		"other secret":       NewUnsubscriber("other", "https://api.example.com").Token(42, "course_updates"),
+		"signature appended": token + "." + signature,
+		// These are signed correctly, but not something Token would issue.
+		"no user":          "course_updates." + u.sign("course_updates"),
+		"non-numeric user": "abc.course_updates." + u.sign("abc.course_updates"),
+		"zero user":        u.Token(0, "course_updates"),
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := u.Verify(token)
+			if !errors.Is(err, ErrInvalidUnsubscribeToken) {
+				t.Errorf("got %v; want ErrInvalidUnsubscribeToken", err)
+			}
+		})
+	}
+}
+
+func TestUnsubscribeURL(t *testing.T) {
+	u := NewUnsubscriber("secret", "https://api.example.com/")
+
+	link, err := url.Parse(u.URL(7, "digest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if link.Host != "api.example.com" || link.Path != "/v1/notifications/unsubscribe" {
+		t.Errorf("got %s", link)
+	}
+
+	userID, category, err := u.Verify(link.Query().Get("token"))
+	if err != nil || userID != 7 || category != "digest" {
+		t.Errorf("got %d, %q, %v from the link's token", userID, category, err)
+	}
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sbeknur/go-final/internal/mailer"
+)
+
+const namespace = "gofinal"
+
+// Metrics holds the Prometheus collectors for the API. It uses its own
+// registry rather than the global one, so only what is registered here is
+// exposed.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	rateLimited     prometheus.Counter
+	mailSent        *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_rejections_total",
+			Help:      "Requests rejected by the rate limiter.",
+		}),
+		mailSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "mail_sent_total",
+			Help:      "Emails handed to the mail transport, by result.",
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.rateLimited,
+		m.mailSent,
+	)
+
+	// Make the mail series show up before the first email is sent.
+	m.mailSent.WithLabelValues("success")
+	m.mailSent.WithLabelValues("failure")
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a completed request. The route must be the pattern
+// the request matched, not its path, to keep the number of series bounded.
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+func (m *Metrics) RateLimited() {
+	m.rateLimited.Inc()
+}
+
+// RegisterDB exposes the connection pool statistics of db.
+func (m *Metrics) RegisterDB(db *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+// RegisterJobs exposes the number of background jobs in each status. counts
+// is called on every scrape, so it has to stay cheap.
+func (m *Metrics) RegisterJobs(counts func(ctx context.Context) (map[string]int64, error)) {
+	m.registry.MustRegister(&jobsCollector{
+		counts: counts,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "jobs"),
+			"Background jobs by status.",
+			[]string{"status"}, nil,
+		),
+	})
+}
+
+type jobsCollector struct {
+	counts func(ctx context.Context) (map[string]int64, error)
+	desc   *prometheus.Desc
+}
+
+func (c *jobsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *jobsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	counts, err := c.counts(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), status)
+	}
+}
+
+// InstrumentTransport counts the emails sent through t.
+func (m *Metrics) InstrumentTransport(t mailer.Transport) mailer.Transport {
+	return &instrumentedTransport{transport: t, sent: m.mailSent}
+}
+
+type instrumentedTransport struct {
+	transport mailer.Transport
+	sent      *prometheus.CounterVec
+}
+
+func (t *instrumentedTransport) Send(msg *mailer.Message) error {
+	err := t.transport.Send(msg)
+	if err != nil {
+		t.sent.WithLabelValues("failure").Inc()
+		return err
+	}
+
+	t.sent.WithLabelValues("success").Inc()
+	return nil
+}
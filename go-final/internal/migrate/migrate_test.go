@@ -0,0 +1,352 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// fakeDB stands in for Postgres. It understands the statements the migrator
+// makes about schema_migrations and the advisory lock, and records every
+// other statement as a migration that ran. A statement containing FAIL
+// returns an error.
+type fakeDB struct {
+	mu      sync.Mutex
+	version int64
+	dirty   bool
+	applied bool // whether schema_migrations has a row
+	locked  int
+	ran     []string
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	db *fakeDB
+	tx *fakeTx
+}
+
+// fakeTx holds the changes of a transaction until it is committed.
+type fakeTx struct {
+	conn    *fakeConn
+	ran     []string
+	version *int64
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.tx = &fakeTx{conn: c}
+	return c.tx, nil
+}
+
+func (tx *fakeTx) Commit() error {
+	db := tx.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.ran = append(db.ran, tx.ran...)
+	if tx.version != nil {
+		db.version, db.dirty, db.applied = *tx.version, false, *tx.version != 0
+	}
+	tx.conn.tx = nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.tx = nil
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	query = strings.TrimSpace(query)
+
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_advisory_lock"):
+		db.locked++
+	case strings.HasPrefix(query, "SELECT pg_advisory_unlock"):
+		db.locked--
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+	case query == "DELETE FROM schema_migrations":
+		var zero int64
+		c.tx.version = &zero
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		version := args[0].Value.(int64)
+		c.tx.version = &version
+	case strings.Contains(query, "FAIL"):
+		return nil, errors.New("syntax error")
+	default:
+		c.tx.ran = append(c.tx.ran, query)
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !strings.HasPrefix(query, "SELECT version, dirty FROM schema_migrations") {
+		return nil, errors.New("unexpected query: " + query)
+	}
+
+	rows := &fakeRows{}
+	if db.applied {
+		rows.values = [][]driver.Value{{db.version, db.dirty}}
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version", "dirty"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var testFS = fstest.MapFS{
+	"000001_create_a.up.sql":   {Data: []byte("create a")},
+	"000001_create_a.down.sql": {Data: []byte("drop a")},
+	"000002_create_b.up.sql":   {Data: []byte("create b")},
+	"000002_create_b.down.sql": {Data: []byte("drop b")},
+	"000010_create_c.up.sql":   {Data: []byte("create c")},
+	"000010_create_c.down.sql": {Data: []byte("drop c")},
+	"README.md":                {Data: []byte("not a migration")},
+}
+
+func newTestMigrator(t *testing.T, fsys fstest.MapFS) (*Migrator, *fakeDB) {
+	t.Helper()
+
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := New(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, fake
+}
+
+func versions(migrations []Migration) []int64 {
+	var v []int64
+	for _, m := range migrations {
+		v = append(v, m.Version)
+	}
+	return v
+}
+
+func TestNew(t *testing.T) {
+	m, _ := newTestMigrator(t, testFS)
+
+	if got := versions(m.migrations); !reflect.DeepEqual(got, []int64{1, 2, 10}) {
+		t.Errorf("got versions %v; want [1 2 10]", got)
+	}
+	if m.Latest() != 10 {
+		t.Errorf("got latest %d; want 10", m.Latest())
+	}
+	if m.migrations[1].Name != "create_b" || m.migrations[1].Up != "create b" || m.migrations[1].Down != "drop b" {
+		t.Errorf("got %+v", m.migrations[1])
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{"000001_a.up.sql": {Data: []byte("create a")}},
+			want: "migration 1_a has no .down.sql file",
+		},
+		{
+			name: "missing up",
+			fsys: fstest.MapFS{"000001_a.down.sql": {Data: []byte("drop a")}},
+			want: "migration 1_a has no .up.sql file",
+		},
+		{
+			name: "empty file is present",
+			fsys: fstest.MapFS{"000001_a.up.sql": {Data: []byte("create a")}, "000001_a.down.sql": {}},
+		},
+		{
+			name: "two names",
+			fsys: fstest.MapFS{"000001_a.up.sql": {}, "000001_b.down.sql": {}},
+			want: "migration 1 has two names: a and b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(nil, tt.fsys)
+
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("got error %q", err)
+			case tt.want != "" && (err == nil || err.Error() != tt.want):
+				t.Errorf("got error %v; want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	m, fake := newTestMigrator(t, testFS)
+	ctx := context.Background()
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(applied); !reflect.DeepEqual(got, []int64{1, 2, 10}) {
+		t.Errorf("applied %v; want [1 2 10]", got)
+	}
+	if fake.version != 10 {
+		t.Errorf("got version %d; want 10", fake.version)
+	}
+
+	_, err = m.Up(ctx)
+	if !errors.Is(err, ErrNoChange) {
+		t.Errorf("got %v running up twice; want ErrNoChange", err)
+	}
+
+	reverted, err := m.Down(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(reverted); !reflect.DeepEqual(got, []int64{10, 2}) {
+		t.Errorf("reverted %v; want [10 2]", got)
+	}
+	if fake.version != 1 {
+		t.Errorf("got version %d; want 1", fake.version)
+	}
+
+	reverted, err = m.Down(ctx, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(reverted); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("reverted %v; want [1]", got)
+	}
+	if fake.applied {
+		t.Errorf("version %d is still recorded after reverting everything", fake.version)
+	}
+
+	_, err = m.Down(ctx, 1)
+	if !errors.Is(err, ErrNoChange) {
+		t.Errorf("got %v reverting with nothing applied; want ErrNoChange", err)
+	}
+
+	want := []string{"create a", "create b", "create c", "drop c", "drop b", "drop a"}
+	if !reflect.DeepEqual(fake.ran, want) {
+		t.Errorf("ran %q; want %q", fake.ran, want)
+	}
+	if fake.locked != 0 {
+		t.Errorf("advisory lock taken %d more times than released", fake.locked)
+	}
+}
+
+func TestUpFromVersion(t *testing.T) {
+	m, fake := newTestMigrator(t, testFS)
+	fake.version, fake.applied = 2, true
+
+	applied, err := m.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(applied); !reflect.DeepEqual(got, []int64{10}) {
+		t.Errorf("applied %v; want [10]", got)
+	}
+
+	status, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != 10 || status.Latest != 10 || len(status.Pending) != 0 {
+		t.Errorf("got status %+v", status)
+	}
+}
+
+func TestUpStopsAtFailure(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000001_a.up.sql":   {Data: []byte("create a")},
+		"000001_a.down.sql": {Data: []byte("drop a")},
+		"000002_b.up.sql":   {Data: []byte("FAIL")},
+		"000002_b.down.sql": {Data: []byte("drop b")},
+		"000003_c.up.sql":   {Data: []byte("create c")},
+		"000003_c.down.sql": {Data: []byte("drop c")},
+	}
+	m, fake := newTestMigrator(t, fsys)
+
+	applied, err := m.Up(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "migration 2_b") {
+		t.Errorf("got error %v; want one naming migration 2_b", err)
+	}
+	if got := versions(applied); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("applied %v; want [1]", got)
+	}
+	if fake.version != 1 {
+		t.Errorf("got version %d; want 1", fake.version)
+	}
+	if fake.locked != 0 {
+		t.Error("advisory lock was not released")
+	}
+}
+
+func TestDirty(t *testing.T) {
+	m, fake := newTestMigrator(t, testFS)
+	fake.version, fake.dirty, fake.applied = 2, true, true
+	ctx := context.Background()
+
+	_, err := m.Up(ctx)
+	if !errors.Is(err, ErrDirty) {
+		t.Errorf("got %v from up; want ErrDirty", err)
+	}
+	_, err = m.Down(ctx, 1)
+	if !errors.Is(err, ErrDirty) {
+		t.Errorf("got %v from down; want ErrDirty", err)
+	}
+	if len(fake.ran) != 0 {
+		t.Errorf("ran %q on a dirty database", fake.ran)
+	}
+
+	err = m.Force(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.version != 1 || fake.dirty {
+		t.Errorf("got version %d dirty %t after force; want 1 clean", fake.version, fake.dirty)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(applied); !reflect.DeepEqual(got, []int64{2, 10}) {
+		t.Errorf("applied %v; want [2 10]", got)
+	}
+}
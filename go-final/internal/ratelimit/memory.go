@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often full buckets are dropped from memory. A full
+// bucket behaves the same as one that doesn't exist.
+const sweepInterval = time.Minute
+
+// Memory keeps buckets in the process. Limits are per instance and are lost
+// on restart.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	bucket
+	fullAt time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets:   make(map[string]*memoryBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	now := time.Now()
+	key = policy.Name + ":" + key
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > sweepInterval {
+		for key, b := range m.buckets {
+			if now.After(b.fullAt) {
+				delete(m.buckets, key)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: policy.newBucket(now)}
+		m.buckets[key] = b
+	}
+
+	var result Result
+	b.bucket, result = policy.take(b.bucket, now)
+	b.fullAt = now.Add(result.Reset)
+
+	return result, nil
+}
+
+func (m *Memory) Peek(ctx context.Context, key string, policy Policy) (Result, error) {
+	now := time.Now()
+	key = policy.Name + ":" + key
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		return policy.peek(policy.newBucket(now), now), nil
+	}
+
+	return policy.peek(b.bucket, now), nil
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryAllow(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	policy := Policy{Name: "ip", Rate: 0.001, Burst: 2}
+
+	for i, want := range []bool{true, true, false} {
+		result, err := m.Allow(ctx, "192.0.2.1", policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != want {
+			t.Errorf("request %d: got allowed %t; want %t", i+1, result.Allowed, want)
+		}
+	}
+
+	// Other keys and other policies have buckets of their own.
+	result, _ := m.Allow(ctx, "192.0.2.2", policy)
+	if !result.Allowed {
+		t.Error("another key was limited")
+	}
+
+	result, _ = m.Allow(ctx, "192.0.2.1", Policy{Name: "auth", Rate: 0.001, Burst: 2})
+	if !result.Allowed {
+		t.Error("another policy was limited")
+	}
+}
+
+func TestMemoryPeek(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	policy := Policy{Name: "ip", Rate: 0.001, Burst: 1}
+
+	for i := 0; i < 2; i++ {
+		result, _ := m.Peek(ctx, "192.0.2.1", policy)
+		if !result.Allowed || result.Remaining != 1 {
+			t.Fatalf("peek %d: got %+v; want an untouched bucket", i+1, result)
+		}
+	}
+
+	m.Allow(ctx, "192.0.2.1", policy)
+
+	result, _ := m.Peek(ctx, "192.0.2.1", policy)
+	if result.Allowed {
+		t.Errorf("got %+v after the bucket was emptied", result)
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	policy := Policy{Name: "ip", Rate: 1, Burst: 1}
+
+	m.Allow(ctx, "full", policy)
+	m.Allow(ctx, "empty", policy)
+
+	// Pretend one bucket has refilled and a sweep is due.
+	m.buckets["ip:full"].fullAt = time.Now().Add(-time.Second)
+	m.buckets["ip:empty"].fullAt = time.Now().Add(time.Hour)
+	m.lastSweep = time.Now().Add(-2 * sweepInterval)
+
+	m.Allow(ctx, "other", policy)
+
+	if _, ok := m.buckets["ip:full"]; ok {
+		t.Error("full bucket was not swept")
+	}
+	if _, ok := m.buckets["ip:empty"]; !ok {
+		t.Error("bucket that isn't full was swept")
+	}
+	if time.Since(m.lastSweep) > time.Second {
+		t.Error("lastSweep was not updated")
+	}
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Postgres keeps buckets in the rate_limits table, so that limits hold
+// across restarts and are shared by all instances.
+type Postgres struct {
+	db *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	key = policy.Name + ":" + key
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	// Creating the bucket if it doesn't exist and locking it are one
+	// statement, since the conflicting update takes the row lock. Concurrent
+	// requests for the same key wait here until this one commits. The
+	// database's clock is used so that instances whose clocks differ agree.
+	var b bucket
+	var now time.Time
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO rate_limits (key, tokens, updated_at, full_at)
+		VALUES ($1, $2, now(), now())
+		ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+		RETURNING tokens, updated_at, now()`,
+		key, policy.Burst,
+	).Scan(&b.tokens, &b.updated, &now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	b, result := policy.take(b, now)
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE rate_limits
+		SET tokens = $2, updated_at = $3, full_at = $4
+		WHERE key = $1`,
+		key, b.tokens, b.updated, now.Add(result.Reset),
+	)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, tx.Commit()
+}
+
+func (p *Postgres) Peek(ctx context.Context, key string, policy Policy) (Result, error) {
+	key = policy.Name + ":" + key
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	var b bucket
+	var now time.Time
+
+	err := p.db.QueryRowContext(ctx, `
+		SELECT tokens, updated_at, now()
+		FROM rate_limits
+		WHERE key = $1`,
+		key,
+	).Scan(&b.tokens, &b.updated, &now)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return policy.peek(policy.newBucket(now), now), nil
+	case err != nil:
+		return Result{}, err
+	}
+
+	return policy.peek(b, now), nil
+}
+
+// DeleteFull removes buckets that have refilled completely and returns how
+// many were deleted. A full bucket behaves the same as one that doesn't
+// exist, so this only keeps the table small.
+func (p *Postgres) DeleteFull(ctx context.Context) (int64, error) {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM rate_limits WHERE full_at < now()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
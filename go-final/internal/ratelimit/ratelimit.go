@@ -0,0 +1,101 @@
+// Package ratelimit implements token bucket rate limiting with buckets kept
+// either in memory or in Postgres, where they are shared by every instance.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Policy is a token bucket: it allows bursts of up to Burst requests, and
+// refills at Rate requests per second.
+type Policy struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// Window is how long an empty bucket takes to refill completely.
+func (p Policy) Window() time.Duration {
+	return seconds(float64(p.Burst) / p.Rate)
+}
+
+// Result describes the bucket after a request was counted against it.
+type Result struct {
+	Allowed bool
+	// Limit is the size of the bucket and Remaining the number of requests
+	// that could be made right now.
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed. It is
+	// zero if this one was.
+	RetryAfter time.Duration
+}
+
+// Limiter counts a request against the bucket for key under policy. Buckets
+// of different policies are separate even if their keys are the same.
+//
+// Peek reports whether a request would be allowed without counting it, for
+// callers that only want to count requests that turn out to be failures.
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (Result, error)
+	Peek(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills b for the time passed since it was last updated and takes a
+// token from it if there is one.
+func (p Policy) take(b bucket, now time.Time) (bucket, Result) {
+	tokens := p.refill(b, now)
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	return bucket{tokens: tokens, updated: now}, p.result(tokens, allowed)
+}
+
+// peek is like take, but leaves the bucket as it is.
+func (p Policy) peek(b bucket, now time.Time) Result {
+	tokens := p.refill(b, now)
+	return p.result(tokens, tokens >= 1)
+}
+
+func (p Policy) refill(b bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	return math.Min(float64(p.Burst), b.tokens+elapsed*p.Rate)
+}
+
+func (p Policy) result(tokens float64, allowed bool) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     p.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(p.Burst) - tokens) / p.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / p.Rate)
+	}
+
+	return result
+}
+
+func (p Policy) newBucket(now time.Time) bucket {
+	return bucket{tokens: float64(p.Burst), updated: now}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
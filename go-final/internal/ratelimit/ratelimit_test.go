@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyTake(t *testing.T) {
+	policy := Policy{Name: "test", Rate: 2, Burst: 4}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		bucket bucket
+		now    time.Time
+		want   Result
+		tokens float64
+	}{
+		{
+			name:   "full bucket",
+			bucket: bucket{tokens: 4, updated: start},
+			now:    start,
+			want:   Result{Allowed: true, Limit: 4, Remaining: 3, Reset: 500 * time.Millisecond},
+			tokens: 3,
+		},
+		{
+			name:   "last token",
+			bucket: bucket{tokens: 1, updated: start},
+			now:    start,
+			want:   Result{Allowed: true, Limit: 4, Remaining: 0, Reset: 2 * time.Second},
+			tokens: 0,
+		},
+		{
+			name:   "empty bucket",
+			bucket: bucket{tokens: 0, updated: start},
+			now:    start,
+			want:   Result{Allowed: false, Limit: 4, Remaining: 0, Reset: 2 * time.Second, RetryAfter: 500 * time.Millisecond},
+			tokens: 0,
+		},
+		{
+			name:   "partly refilled",
+			bucket: bucket{tokens: 0, updated: start},
+			now:    start.Add(250 * time.Millisecond),
+			want:   Result{Allowed: false, Limit: 4, Remaining: 0, Reset: 1750 * time.Millisecond, RetryAfter: 250 * time.Millisecond},
+			tokens: 0.5,
+		},
+		{
+			name:   "refilled enough",
+			bucket: bucket{tokens: 0.5, updated: start},
+			now:    start.Add(time.Second),
+			want:   Result{Allowed: true, Limit: 4, Remaining: 1, Reset: 1250 * time.Millisecond},
+			tokens: 1.5,
+		},
+		{
+			name:   "refill is capped at burst",
+			bucket: bucket{tokens: 0, updated: start},
+			now:    start.Add(time.Hour),
+			want:   Result{Allowed: true, Limit: 4, Remaining: 3, Reset: 500 * time.Millisecond},
+			tokens: 3,
+		},
+		{
+			name:   "clock going backwards",
+			bucket: bucket{tokens: 1, updated: start},
+			now:    start.Add(-time.Second),
+			want:   Result{Allowed: true, Limit: 4, Remaining: 0, Reset: 2 * time.Second},
+			tokens: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, got := policy.take(tt.bucket, tt.now)
+
+			if got != tt.want {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+			if b.tokens != tt.tokens {
+				t.Errorf("got %v tokens left; want %v", b.tokens, tt.tokens)
+			}
+			if !b.updated.Equal(tt.now) {
+				t.Errorf("got updated %v; want %v", b.updated, tt.now)
+			}
+		})
+	}
+}
+
+func TestPolicyPeek(t *testing.T) {
+	policy := Policy{Name: "test", Rate: 1, Burst: 2}
+	now := time.Now()
+
+	got := policy.peek(bucket{tokens: 1, updated: now}, now)
+	want := Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}
+	if got != want {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+
+	got = policy.peek(bucket{tokens: 0.25, updated: now}, now)
+	want = Result{Allowed: false, Limit: 2, Remaining: 0, Reset: 1750 * time.Millisecond, RetryAfter: 750 * time.Millisecond}
+	if got != want {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+}
+
+func TestPolicyWindow(t *testing.T) {
+	policy := Policy{Rate: 0.1, Burst: 5}
+
+	if got := policy.Window(); got != 50*time.Second {
+		t.Errorf("got %v; want 50s", got)
+	}
+}
@@ -0,0 +1,207 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var tracer = otel.Tracer("github.com/sbeknur/go-final/internal/scheduler")
+
+// Task is a function run on a cron schedule.
+type Task func(ctx context.Context) error
+
+type entry struct {
+	name     string
+	schedule cron.Schedule
+	task     Task
+	next     time.Time
+}
+
+// Scheduler runs tasks on cron schedules. Every API instance runs a
+// scheduler, but for each tick only the instance that wins a Postgres
+// advisory lock for the task runs it; the others skip that tick.
+type Scheduler struct {
+	db      *sql.DB
+	logger  *jsonlog.Logger
+	timeout time.Duration
+	entries []*entry
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func New(db *sql.DB, logger *jsonlog.Logger, timeout time.Duration) *Scheduler {
+	return &Scheduler{
+		db:      db,
+		logger:  logger,
+		timeout: timeout,
+		stop:    make(chan struct{}),
+	}
+}
+
+// Add registers a task using a standard five-field cron expression, e.g.
+// "0 3 * * *" for every day at 03:00 UTC. An empty spec disables the task.
+func (s *Scheduler) Add(name, spec string, task Task) error {
+	if spec == "" {
+		return nil
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return err
+	}
+
+	s.entries = append(s.entries, &entry{name: name, schedule: schedule, task: task})
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	if len(s.entries) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, e := range s.entries {
+		e.next = e.schedule.Next(now)
+	}
+
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			next := s.entries[0].next
+			for _, e := range s.entries[1:] {
+				if e.next.Before(next) {
+					next = e.next
+				}
+			}
+
+			timer := time.NewTimer(time.Until(next))
+
+			select {
+			case <-timer.C:
+				now := time.Now().UTC()
+				for _, e := range s.entries {
+					if e.next.After(now) {
+						continue
+					}
+
+					s.wg.Add(1)
+					go func(e *entry, tick time.Time) {
+						defer s.wg.Done()
+						s.run(e, tick)
+					}(e, e.next)
+
+					e.next = e.schedule.Next(now)
+				}
+
+			case <-s.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for running tasks to finish.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run(e *entry, tick time.Time) {
+	logger := s.logger.With("component", "scheduler", "task", e.name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	// Session level advisory locks belong to a connection, so hold on to one
+	// for the whole run.
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	defer conn.Close()
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, lockKey(e.name)).Scan(&locked)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	if !locked {
+		return
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey(e.name))
+
+	// Another instance may already have run this tick and released the lock
+	// before we asked for it. Recording the tick makes the run idempotent.
+	query := `
+		INSERT INTO scheduler_runs (name, last_run_at)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET last_run_at = EXCLUDED.last_run_at
+		WHERE scheduler_runs.last_run_at < EXCLUDED.last_run_at`
+
+	result, err := conn.ExecContext(ctx, query, e.name, tick)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	if rowsAffected == 0 {
+		return
+	}
+
+	start := time.Now()
+
+	err = s.execute(ctx, e)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	logger.Info("scheduled task completed", jsonlog.Duration("duration", time.Since(start)))
+}
+
+func (s *Scheduler) execute(ctx context.Context, e *entry) (err error) {
+	ctx, span := tracer.Start(ctx, "task "+e.name)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return e.task(ctx)
+}
+
+// lockKey derives a stable advisory lock key from the task name.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("scheduler:" + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,217 @@
+// Package settings fills a flag.FlagSet from a config file and environment
+// variables. Every setting is a flag, and its name is also its key in the
+// config file and, upper-cased with a prefix, its environment variable:
+//
+//	-db-max-open-conns   db-max-open-conns: 25   GOFINAL_DB_MAX_OPEN_CONNS=25
+//
+// Sources are applied in order of increasing precedence: flag defaults, the
+// config file, environment variables and finally flags given on the command
+// line.
+package settings
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Mask replaces secrets other than URLs when printing the configuration.
+const Mask = "********"
+
+type Loader struct {
+	FlagSet *flag.FlagSet
+	// EnvPrefix is prepended to environment variable names, e.g. "GOFINAL".
+	EnvPrefix string
+	// Secrets names the flags whose values are masked by Print.
+	Secrets []string
+}
+
+// Load applies the config file at path, if any, and then the environment to
+// every flag that wasn't set on the command line. It must be called after
+// the flag set has been parsed. If path is empty the <prefix>_CONFIG
+// environment variable is used instead.
+//
+// Any setting may also be read from a file named by <VAR>_FILE, e.g.
+// GOFINAL_DB_DSN_FILE=/run/secrets/dsn, which is how container platforms
+// usually provide secrets.
+func (l *Loader) Load(path string) error {
+	explicit := make(map[string]bool)
+	l.FlagSet.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if path == "" {
+		path = os.Getenv(l.EnvPrefix + "_CONFIG")
+	}
+
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return err
+		}
+
+		for name, value := range values {
+			if l.FlagSet.Lookup(name) == nil {
+				return fmt.Errorf("%s: unknown setting %q", path, name)
+			}
+			if explicit[name] {
+				continue
+			}
+
+			err := l.FlagSet.Set(name, value)
+			if err != nil {
+				return fmt.Errorf("%s: invalid value for %s: %w", path, name, err)
+			}
+		}
+	}
+
+	var err error
+	l.FlagSet.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] {
+			return
+		}
+
+		value, ok, envErr := l.lookupEnv(f.Name)
+		if envErr != nil {
+			err = envErr
+			return
+		}
+		if !ok {
+			return
+		}
+
+		setErr := l.FlagSet.Set(f.Name, value)
+		if setErr != nil {
+			err = fmt.Errorf("invalid value for %s: %w", l.EnvVar(f.Name), setErr)
+		}
+	})
+
+	return err
+}
+
+// EnvVar returns the environment variable for a flag name.
+func (l *Loader) EnvVar(name string) string {
+	return l.EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func (l *Loader) lookupEnv(name string) (string, bool, error) {
+	key := l.EnvVar(name)
+
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true, nil
+	}
+
+	path, ok := os.LookupEnv(key + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", key, err)
+	}
+
+	// Files written by editors and secret stores usually end in a newline
+	// that isn't part of the value.
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
+
+// Print writes the effective configuration in the config file format, in
+// YAML, with secrets masked.
+func (l *Loader) Print(w io.Writer) error {
+	secrets := make(map[string]bool, len(l.Secrets))
+	for _, name := range l.Secrets {
+		secrets[name] = true
+	}
+
+	var err error
+	l.FlagSet.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+
+		value := f.Value.String()
+		if secrets[f.Name] {
+			value = maskSecret(value)
+		}
+
+		_, err = fmt.Fprintf(w, "%s: %q\n", f.Name, value)
+	})
+
+	return err
+}
+
+// maskSecret hides a secret. Only the password of a URL is masked, so that a
+// DSN still shows which database is used.
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		return u.Redacted()
+	}
+
+	return Mask
+}
+
+// readFile reads a YAML or TOML config file, depending on its extension, and
+// flattens nested tables so that
+//
+//	db:
+//	  max-open-conns: 25
+//
+// becomes db-max-open-conns.
+func readFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	default:
+		return nil, errors.New("config file must have a .yaml, .yml or .toml extension")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten("", raw, values)
+	return values, nil
+}
+
+func flatten(prefix string, raw map[string]any, values map[string]string) {
+	for key, value := range raw {
+		if prefix != "" {
+			key = prefix + "-" + key
+		}
+
+		switch v := value.(type) {
+		case map[string]any:
+			flatten(key, v, values)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+}
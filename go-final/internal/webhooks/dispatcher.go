@@ -0,0 +1,180 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+)
+
+const (
+	batchSize = 10
+	// lease must comfortably exceed the HTTP client timeout so that a slow
+	// receiver doesn't get the same delivery twice.
+	lease = time.Minute
+)
+
+// Dispatcher periodically sends due webhook deliveries. Several API instances
+// can run one at the same time; the database hands each delivery to only
+// one of them.
+type Dispatcher struct {
+	models       data.WebhookModel
+	logger       *jsonlog.Logger
+	client       *http.Client
+	pollInterval time.Duration
+	maxAttempts  int
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewDispatcher(models data.WebhookModel, logger *jsonlog.Logger, pollInterval time.Duration, maxAttempts int) *Dispatcher {
+	return &Dispatcher{
+		models:       models,
+		logger:       logger,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		pollInterval: pollInterval,
+		maxAttempts:  maxAttempts,
+		stop:         make(chan struct{}),
+	}
+}
+
+func (d *Dispatcher) Start() {
+	d.wg.Add(1)
+
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				d.dispatchDue()
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the batch in flight to finish. Deliveries that were claimed
+// but not attempted become due again when their lease runs out.
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) dispatchDue() {
+	for {
+		deliveries, err := d.models.ClaimDue(context.Background(), batchSize, lease)
+		if err != nil {
+			d.logger.PrintError(err, map[string]string{"component": "webhooks"})
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery *data.WebhookDelivery) {
+				defer wg.Done()
+				d.deliver(delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(deliveries) < batchSize {
+			return
+		}
+
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(delivery *data.WebhookDelivery) {
+	statusCode, err := d.send(delivery)
+
+	var retryAt time.Time
+	if err != nil && delivery.Attempts+1 < d.maxAttempts {
+		retryAt = time.Now().Add(Backoff(delivery.Attempts + 1))
+	}
+
+	err = d.models.RecordAttempt(context.Background(), delivery, statusCode, err, retryAt)
+	if err != nil {
+		d.logger.PrintError(err, map[string]string{
+			"component":   "webhooks",
+			"delivery_id": strconv.FormatInt(delivery.ID, 10),
+		})
+	}
+}
+
+func (d *Dispatcher) send(delivery *data.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ProEdu-Webhooks/1.0")
+	req.Header.Set("X-Webhook-ID", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Drain a little of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver responded with status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>". Including
+// the timestamp lets receivers reject replayed requests.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait before the given attempt: 30s doubling
+// each time up to six hours, with up to 20% jitter.
+func Backoff(attempt int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempt && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
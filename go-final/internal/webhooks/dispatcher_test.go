@@ -0,0 +1,159 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sbeknur/go-final/internal/data"
+	"github.com/sbeknur/go-final/internal/dbtest"
+	"github.com/sbeknur/go-final/internal/jsonlog"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":1}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000.{\"id\":1}"))
+	want := hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("secret", "1700000000", body); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	if Sign("secret", "1700000001", body) == want {
+		t.Error("signature doesn't depend on the timestamp")
+	}
+	if Sign("other", "1700000000", body) == want {
+		t.Error("signature doesn't depend on the secret")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{9, 128 * time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := Backoff(tt.attempt)
+			if got < tt.base || got > tt.base+tt.base/5 {
+				t.Errorf("attempt %d: got %s; want between %s and %s", tt.attempt, got, tt.base, tt.base+tt.base/5)
+				break
+			}
+		}
+	}
+}
+
+// attempt is what the dispatcher recorded about a delivery.
+type attempt struct {
+	status     string
+	attempts   int
+	statusCode *int
+	retry      bool
+}
+
+// dispatchOnce claims a single delivery to url with the given number of
+// earlier attempts, sends it and returns what was recorded.
+func dispatchOnce(t *testing.T, url string, attempts, maxAttempts int) attempt {
+	t.Helper()
+
+	db, stub := dbtest.New(t)
+	stub.Query("webhook_deliveries.id IN", func(args []any) (*dbtest.Rows, error) {
+		return &dbtest.Rows{
+			Columns: []string{"id", "created_at", "webhook_id", "event_type", "payload", "attempts", "url", "secret"},
+			Values:  [][]any{{int64(7), time.Now(), int64(3), data.EventUserActivated, []byte(`{"id":1}`), int64(attempts), url, "secret"}},
+		}, nil
+	})
+
+	var recorded []attempt
+	stub.Exec("UPDATE webhook_deliveries SET status = $1", func(args []any) (int64, error) {
+		recorded = append(recorded, attempt{
+			status:     args[0].(string),
+			attempts:   int(args[1].(int)),
+			statusCode: args[2].(*int),
+			retry:      args[4].(*time.Time) != nil,
+		})
+		return 1, nil
+	})
+
+	d := NewDispatcher(data.WebhookModel{DB: db}, jsonlog.New(io.Discard, jsonlog.LevelOff), time.Second, maxAttempts)
+	d.dispatchDue()
+
+	if len(recorded) != 1 {
+		t.Fatalf("got %d recorded attempts; want 1", len(recorded))
+	}
+	return recorded[0]
+}
+
+func TestDeliver(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer receiver.Close()
+
+	a := dispatchOnce(t, receiver.URL, 0, 3)
+
+	if a.status != data.DeliverySucceeded || a.attempts != 1 || a.statusCode == nil || *a.statusCode != http.StatusOK {
+		t.Errorf("got %+v; want a succeeded first attempt with status 200", a)
+	}
+
+	if got.Header.Get("X-Webhook-ID") != "7" || got.Header.Get("X-Webhook-Event") != data.EventUserActivated {
+		t.Errorf("got headers %v", got.Header)
+	}
+	if string(body) != `{"id":1}` {
+		t.Errorf("got body %q", body)
+	}
+
+	timestamp := got.Header.Get("X-Webhook-Timestamp")
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		t.Errorf("got timestamp %q", timestamp)
+	}
+	if sig := got.Header.Get("X-Webhook-Signature"); sig != "sha256="+Sign("secret", timestamp, body) {
+		t.Errorf("got signature %q", sig)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	a := dispatchOnce(t, receiver.URL, 0, 3)
+	if a.status != data.DeliveryPending || !a.retry || a.attempts != 1 || *a.statusCode != http.StatusServiceUnavailable {
+		t.Errorf("first failure: got %+v; want a pending delivery with a retry", a)
+	}
+
+	a = dispatchOnce(t, receiver.URL, 2, 3)
+	if a.status != data.DeliveryFailed || a.retry || a.attempts != 3 {
+		t.Errorf("last failure: got %+v; want a failed delivery", a)
+	}
+}
+
+func TestDeliverUnreachable(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	a := dispatchOnce(t, url, 0, 3)
+	if a.status != data.DeliveryPending || !a.retry || a.statusCode != nil {
+		t.Errorf("got %+v; want a pending delivery with no status code", a)
+	}
+}
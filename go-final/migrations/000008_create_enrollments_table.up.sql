@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS enrollments (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    course_id bigint NOT NULL REFERENCES courses ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, course_id)
+);
+
+CREATE INDEX IF NOT EXISTS enrollments_course_id_idx ON enrollments (course_id);
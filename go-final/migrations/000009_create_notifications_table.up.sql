@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    category text NOT NULL,
+    title text NOT NULL,
+    body text NOT NULL,
+    read_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS scheduler_runs (
+    name text PRIMARY KEY,
+    last_run_at timestamp with time zone NOT NULL
+);
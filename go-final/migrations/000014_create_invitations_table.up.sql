@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    email citext NOT NULL,
+    role text NOT NULL,
+    invited_by bigint REFERENCES users ON DELETE SET NULL,
+    hash bytea UNIQUE,
+    expiry timestamp(0) with time zone NOT NULL,
+    accepted_at timestamp(0) with time zone
+);
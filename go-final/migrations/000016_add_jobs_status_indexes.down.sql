@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS jobs_finished_at_idx;
+DROP INDEX IF EXISTS jobs_status_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS jobs_status_idx ON jobs (status);
+CREATE INDEX IF NOT EXISTS jobs_finished_at_idx ON jobs (finished_at) WHERE status IN ('succeeded', 'failed');